@@ -0,0 +1,271 @@
+package detector
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BannerPorts 抓取明文Banner的端口：FTP、Telnet、SMTP、POP3、IMAP
+var BannerPorts = []int{21, 23, 25, 110, 143}
+
+// Telnet 选项协商命令
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+)
+
+//go:embed banner_signatures.txt
+var defaultBannerSignatures string
+
+// bannerSignature 签名文件中的一条Banner匹配规则
+type bannerSignature struct {
+	Ports   map[int]bool // 为空表示匹配所有端口
+	OS      []string
+	Product string
+	Pattern *regexp.Regexp
+}
+
+// BannerMatch Banner匹配结果
+type BannerMatch struct {
+	Port    int
+	Banner  string
+	Product string
+	Version string
+	OS      []string
+}
+
+// BannerFingerprint 抓取FTP、Telnet、SMTP、POP3、IMAP的Banner并按签名文件匹配操作系统
+func (d *OSDetector) BannerFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	signatures, err := d.loadBannerSignatures()
+	if err != nil {
+		log.Println("加载Banner签名文件失败，使用内置签名:", err)
+		signatures, _ = parseBannerSignatures(strings.NewReader(defaultBannerSignatures))
+	}
+
+	d.bannerMatches = nil
+	for _, port := range BannerPorts {
+		banner, err := grabBanner(targetIP, port)
+		if err != nil || banner == "" {
+			continue
+		}
+		if d.Verbose {
+			fmt.Printf("[Banner] Port %d: %q\n", port, banner)
+		}
+
+		match := matchBanner(signatures, port, banner)
+		if match == nil {
+			continue
+		}
+		d.bannerMatches = append(d.bannerMatches, match)
+		d.addDetail("Banner %d: %s %s", port, match.Product, match.Version)
+
+		portSet := newOSSet(match.OS)
+		// Banner中的发行版标记可以进一步缩小范围
+		if distroSet := d.intersectOSSets(portSet, osSetFromVersionString(banner)); len(distroSet) > 0 {
+			portSet = distroSet
+		}
+		for os := range portSet {
+			d.osWeights[os] += 2
+		}
+
+		// 多个端口的结果取交集，出现矛盾时保留已有结果
+		if len(resultSet) == 0 {
+			resultSet = portSet
+		} else if merged := d.intersectOSSets(resultSet, portSet); len(merged) > 0 {
+			resultSet = merged
+		} else {
+			log.Printf("端口 %d 的Banner与其他端口的结果矛盾: %s\n", port, match.Product)
+		}
+	}
+
+	if len(resultSet) > 0 {
+		log.Println("Banner匹配结果:", d.formatOSSet(resultSet))
+	}
+
+	return resultSet
+}
+
+// BannerMatches 返回Banner签名匹配结果，未探测或无响应时为nil
+func (d *OSDetector) BannerMatches() []*BannerMatch {
+	return d.bannerMatches
+}
+
+// loadBannerSignatures 加载用户指定的签名文件，未指定时使用内置签名
+func (d *OSDetector) loadBannerSignatures() ([]bannerSignature, error) {
+	if d.BannerSignatureFile == "" {
+		return parseBannerSignatures(strings.NewReader(defaultBannerSignatures))
+	}
+	f, err := os.Open(d.BannerSignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseBannerSignatures(f)
+}
+
+// parseBannerSignatures 解析签名文件，每行为 端口<TAB>操作系统<TAB>产品<TAB>正则表达式
+func parseBannerSignatures(r io.Reader) ([]bannerSignature, error) {
+	var signatures []bannerSignature
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 tab-separated fields", lineNo)
+		}
+
+		sig := bannerSignature{Ports: make(map[int]bool), Product: fields[2]}
+		if fields[0] != "*" {
+			for _, p := range strings.Split(fields[0], ",") {
+				port, err := strconv.Atoi(strings.TrimSpace(p))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid port %q", lineNo, p)
+				}
+				sig.Ports[port] = true
+			}
+		}
+		for _, name := range strings.Split(fields[1], ",") {
+			osList, err := expandOSName(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			sig.OS = append(sig.OS, osList...)
+		}
+		pattern, err := regexp.Compile(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		sig.Pattern = pattern
+
+		signatures = append(signatures, sig)
+	}
+	return signatures, scanner.Err()
+}
+
+// expandOSName 展开签名文件中的系列别名并检查系统名称
+func expandOSName(name string) ([]string, error) {
+	switch name {
+	case "Windows":
+		return WindowsFamily, nil
+	case "WindowsServer":
+		return WindowsServerFamily, nil
+	case "Linux":
+		return LinuxFamily, nil
+	case "Unix":
+		return append(append([]string{}, LinuxFamily...), "FreeBSD"), nil
+	}
+	for _, os := range AllOS {
+		if os == name {
+			return []string{name}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operating system %q", name)
+}
+
+// matchBanner 按顺序匹配签名，返回第一条匹配结果
+func matchBanner(signatures []bannerSignature, port int, banner string) *BannerMatch {
+	for _, sig := range signatures {
+		if len(sig.Ports) > 0 && !sig.Ports[port] {
+			continue
+		}
+		m := sig.Pattern.FindStringSubmatch(banner)
+		if m == nil {
+			continue
+		}
+		match := &BannerMatch{Port: port, Banner: banner, Product: sig.Product, OS: sig.OS}
+		if len(m) > 1 {
+			match.Version = m[1]
+		}
+		return match
+	}
+	return nil
+}
+
+// grabBanner 连接端口并读取服务主动发送的Banner
+func grabBanner(targetIP string, port int) (string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, strconv.Itoa(port)), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT) * time.Second))
+
+	if port == 23 {
+		return readTelnetBanner(conn)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readTelnetBanner 拒绝所有选项协商，读取登录提示之前的文本
+func readTelnetBanner(conn net.Conn) (string, error) {
+	var text []byte
+	buffer := make([]byte, 1024)
+	for len(text) < 4096 {
+		n, err := conn.Read(buffer)
+		if n == 0 && err != nil {
+			break
+		}
+
+		var reply []byte
+		data := buffer[:n]
+		for i := 0; i < len(data); i++ {
+			if data[i] != telnetIAC || i+1 >= len(data) {
+				if data[i] >= 0x20 || data[i] == '\n' {
+					text = append(text, data[i])
+				}
+				continue
+			}
+			switch cmd := data[i+1]; cmd {
+			case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+				if i+2 < len(data) {
+					if cmd == telnetDO {
+						reply = append(reply, telnetIAC, telnetWONT, data[i+2])
+					} else if cmd == telnetWILL {
+						reply = append(reply, telnetIAC, telnetDONT, data[i+2])
+					}
+				}
+				i += 2
+			case telnetSB:
+				// 跳过子协商直到IAC SE
+				for i += 2; i+1 < len(data) && !(data[i] == telnetIAC && data[i+1] == telnetSE); i++ {
+				}
+				i++
+			default:
+				i++
+			}
+		}
+		if len(reply) > 0 {
+			conn.Write(reply)
+		}
+
+		lower := strings.ToLower(string(text))
+		if strings.Contains(lower, "login") || strings.Contains(lower, "username") || strings.Contains(lower, "password") {
+			break
+		}
+	}
+	return strings.TrimSpace(string(text)), nil
+}
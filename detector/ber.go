@@ -0,0 +1,156 @@
+package detector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER 通用标签
+const (
+	berTagBoolean     = 0x01
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagNull        = 0x05
+	berTagOID         = 0x06
+	berTagEnumerated  = 0x0a
+	berTagSequence    = 0x30
+	berTagSet         = 0x31
+)
+
+// berElement BER编码的TLV元素，仅支持单字节标签
+type berElement struct {
+	Tag   byte
+	Value []byte
+}
+
+// berTLV 编码一个TLV元素
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	out = append(out, berLength(len(value))...)
+	return append(out, value...)
+}
+
+// berSequence 将多个已编码的元素组合为一个构造类型元素
+func berSequence(tag byte, children ...[]byte) []byte {
+	var value []byte
+	for _, child := range children {
+		value = append(value, child...)
+	}
+	return berTLV(tag, value)
+}
+
+// berLength 编码长度字段
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var out []byte
+	for v := n; v > 0; v >>= 8 {
+		out = append([]byte{byte(v)}, out...)
+	}
+	return append([]byte{0x80 | byte(len(out))}, out...)
+}
+
+// berInteger 编码整数
+func berInteger(tag byte, v int64) []byte {
+	value := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		value = append([]byte{byte(v)}, value...)
+	}
+	return berTLV(tag, value)
+}
+
+// berOID 编码对象标识符，例如 "1.3.6.1.2.1.1.1.0"
+func berOID(oid string) []byte {
+	parts := strings.Split(oid, ".")
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arcs[i], _ = strconv.ParseUint(part, 10, 64)
+	}
+	if len(arcs) < 2 {
+		return berTLV(berTagOID, nil)
+	}
+
+	value := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, arc := range arcs[2:] {
+		chunk := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			chunk = append([]byte{byte(arc&0x7f) | 0x80}, chunk...)
+		}
+		value = append(value, chunk...)
+	}
+	return berTLV(berTagOID, value)
+}
+
+// parseBER 解析一个TLV元素，返回元素和剩余数据
+func parseBER(data []byte) (berElement, []byte, error) {
+	if len(data) < 2 {
+		return berElement{}, nil, fmt.Errorf("BER data too short")
+	}
+	elem := berElement{Tag: data[0]}
+
+	length := int(data[1])
+	off := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || off+n > len(data) {
+			return berElement{}, nil, fmt.Errorf("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[off : off+n] {
+			length = length<<8 | int(b)
+		}
+		off += n
+	}
+	if length < 0 || off+length > len(data) {
+		return berElement{}, nil, fmt.Errorf("truncated BER element")
+	}
+
+	elem.Value = data[off : off+length]
+	return elem, data[off+length:], nil
+}
+
+// children 解析构造类型元素的子元素
+func (e berElement) children() ([]berElement, error) {
+	var elems []berElement
+	for rest := e.Value; len(rest) > 0; {
+		elem, next, err := parseBER(rest)
+		if err != nil {
+			return elems, err
+		}
+		elems = append(elems, elem)
+		rest = next
+	}
+	return elems, nil
+}
+
+// int 解码整数值
+func (e berElement) int() int64 {
+	var v int64
+	for i, b := range e.Value {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+// oid 解码对象标识符
+func (e berElement) oid() string {
+	if len(e.Value) == 0 {
+		return ""
+	}
+	arcs := []string{strconv.Itoa(int(e.Value[0]) / 40), strconv.Itoa(int(e.Value[0]) % 40)}
+	var arc uint64
+	for _, b := range e.Value[1:] {
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+			arc = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
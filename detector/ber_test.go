@@ -0,0 +1,129 @@
+package detector
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBEREncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"integer 0", berInteger(berTagInteger, 0), []byte{0x02, 0x01, 0x00}},
+		{"integer 127", berInteger(berTagInteger, 127), []byte{0x02, 0x01, 0x7f}},
+		{"integer 128", berInteger(berTagInteger, 128), []byte{0x02, 0x02, 0x00, 0x80}},
+		{"integer 256", berInteger(berTagInteger, 256), []byte{0x02, 0x02, 0x01, 0x00}},
+		{"integer -1", berInteger(berTagInteger, -1), []byte{0x02, 0x01, 0xff}},
+		{"integer -129", berInteger(berTagInteger, -129), []byte{0x02, 0x02, 0xff, 0x7f}},
+		{"sysDescr OID", berOID("1.3.6.1.2.1.1.1.0"), []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00}},
+		{"RSA OID", berOID("1.2.840.113549"), []byte{0x06, 0x06, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d}},
+		{"short length", berLength(127), []byte{0x7f}},
+		{"long length", berLength(200), []byte{0x81, 0xc8}},
+		{"two byte length", berLength(300), []byte{0x82, 0x01, 0x2c}},
+		{"sequence", berSequence(berTagSequence, berInteger(berTagInteger, 1), berTLV(berTagOctetString, []byte("public"))),
+			[]byte{0x30, 0x0b, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c'}},
+	}
+
+	for _, tt := range tests {
+		if !bytes.Equal(tt.got, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseBER(t *testing.T) {
+	long := berTLV(berTagOctetString, bytes.Repeat([]byte{'a'}, 300))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		tag      byte
+		valueLen int
+		restLen  int
+	}{
+		{name: "short form", data: []byte{0x02, 0x01, 0x05, 0xff}, tag: berTagInteger, valueLen: 1, restLen: 1},
+		{name: "long form", data: long, tag: berTagOctetString, valueLen: 300},
+		{name: "empty value", data: []byte{0x05, 0x00}, tag: berTagNull},
+		{name: "too short", data: []byte{0x30}, wantErr: true},
+		{name: "truncated value", data: []byte{0x04, 0x05, 'a', 'b'}, wantErr: true},
+		{name: "truncated long length", data: []byte{0x04, 0x82, 0x01}, wantErr: true},
+		{name: "indefinite length", data: []byte{0x30, 0x80, 0x00, 0x00}, wantErr: true},
+		{name: "oversized length", data: []byte{0x04, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elem, rest, err := parseBER(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseBER() = %+v, want error", elem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBER() error: %v", err)
+			}
+			if elem.Tag != tt.tag || len(elem.Value) != tt.valueLen || len(rest) != tt.restLen {
+				t.Errorf("parseBER() = tag %#02x, %d value bytes, %d remaining; want tag %#02x, %d, %d",
+					elem.Tag, len(elem.Value), len(rest), tt.tag, tt.valueLen, tt.restLen)
+			}
+		})
+	}
+}
+
+func TestBERDecoding(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, 65535, 1 << 31, -1, -128, -129, -65536} {
+		elem, _, err := parseBER(berInteger(berTagInteger, v))
+		if err != nil {
+			t.Fatalf("parseBER(berInteger(%d)) error: %v", v, err)
+		}
+		if got := elem.int(); got != v {
+			t.Errorf("int() = %d, want %d", got, v)
+		}
+	}
+
+	for _, oid := range []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.311.1.1.3.1.2", "1.2.840.113554.1.2.2"} {
+		elem, _, err := parseBER(berOID(oid))
+		if err != nil {
+			t.Fatalf("parseBER(berOID(%q)) error: %v", oid, err)
+		}
+		if got := elem.oid(); got != oid {
+			t.Errorf("oid() = %q, want %q", got, oid)
+		}
+	}
+}
+
+func TestBERChildren(t *testing.T) {
+	// SNMPv1 GetResponse: version、community、PDU
+	msg := berSequence(berTagSequence,
+		berInteger(berTagInteger, 0),
+		berTLV(berTagOctetString, []byte("public")),
+		berSequence(0xa2, berInteger(berTagInteger, 0x1234)),
+	)
+
+	elem, _, err := parseBER(msg)
+	if err != nil {
+		t.Fatalf("parseBER() error: %v", err)
+	}
+	fields, err := elem.children()
+	if err != nil {
+		t.Fatalf("children() error: %v", err)
+	}
+	if len(fields) != 3 || fields[0].int() != 0 || string(fields[1].Value) != "public" || fields[2].Tag != 0xa2 {
+		t.Fatalf("children() = %+v", fields)
+	}
+
+	pdu, err := fields[2].children()
+	if err != nil || len(pdu) != 1 || pdu[0].int() != 0x1234 {
+		t.Errorf("PDU children() = %+v, %v", pdu, err)
+	}
+
+	// 截断的子元素返回已解析的部分和错误
+	broken := berElement{Tag: berTagSequence, Value: []byte{0x02, 0x01, 0x01, 0x04, 0x05, 'a'}}
+	if fields, err := broken.children(); err == nil || len(fields) != 1 {
+		t.Errorf("children() on truncated value = %+v, %v; want 1 element and error", fields, err)
+	}
+}
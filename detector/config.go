@@ -1,44 +1,105 @@
 package detector
 
+import "slices"
+
 // AllOS 定义所有支持的操作系统
 var AllOS = []string{
-	"Linux", "FreeBSD", "Windows XP", "Windows 7", "Windows 10", "Windows 11",
-	"Symbian", "Palm OS", "Centos", "Ubuntu", "Debain",
+	"Linux", "FreeBSD", "Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11",
+	"Symbian", "Palm OS", "Centos", "Ubuntu", "Debain", "Cisco IOS",
+	"Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016",
+	"Windows Server 2019", "Windows Server 2022", "Windows Server 2025", "macOS", "iOS",
+}
+
+// LinuxFamily 定义Linux及其发行版
+var LinuxFamily = []string{"Linux", "Centos", "Ubuntu", "Debain"}
+
+// AppleFamily 定义Apple操作系统
+var AppleFamily = []string{"macOS", "iOS"}
+
+// BSDFamily 定义BSD系操作系统，Apple系统的网络协议栈源自FreeBSD
+var BSDFamily = append([]string{"FreeBSD"}, AppleFamily...)
+
+// EmbeddedFamily 定义网络设备和嵌入式操作系统
+var EmbeddedFamily = []string{"Cisco IOS", "Symbian", "Palm OS"}
+
+// WindowsServerFamily 定义Windows Server系列操作系统，R2版本与对应的主版本合并
+var WindowsServerFamily = []string{
+	"Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016",
+	"Windows Server 2019", "Windows Server 2022", "Windows Server 2025",
 }
 
+// WindowsClientFamily 定义Windows桌面版操作系统
+var WindowsClientFamily = []string{"Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11"}
+
+// WindowsFamily 定义Windows系列操作系统
+var WindowsFamily = append(append([]string{}, WindowsClientFamily...), WindowsServerFamily...)
+
+// NonWindowsFamily 定义Windows以外的操作系统
+var NonWindowsFamily = func() []string {
+	var list []string
+	for _, os := range AllOS {
+		if !slices.Contains(WindowsFamily, os) {
+			list = append(list, os)
+		}
+	}
+	return list
+}()
+
+// InitialTTLs 常见协议栈使用的初始TTL
+var InitialTTLs = []int{32, 60, 64, 128, 255}
+
 // OSDB 定义操作系统指纹数据库
 var OSDB = map[string]map[interface{}][]string{
 	"DF": {
-		true:  {"FreeBSD", "Linux", "Windows XP", "Windows 7", "Windows 10", "Windows 11", "Centos", "Ubuntu", "Debain"},
-		false: {"FreeBSD", "Symbian", "Palm OS", "Linux", "Windows XP", "Windows 7", "Windows 10", "Windows 11", "Centos", "Ubuntu"},
+		true:  {"FreeBSD", "Linux", "Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11", "Centos", "Ubuntu", "Debain", "Cisco IOS", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025", "macOS", "iOS"},
+		false: {"FreeBSD", "Symbian", "Palm OS", "Linux", "Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11", "Centos", "Ubuntu", "Cisco IOS", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
 	},
 	"TTL": {
-		64:  {"Linux", "FreeBSD", "Centos", "Ubuntu"},
-		128: {"Windows XP", "Windows 7", "Windows 10", "Windows 11"},
-		256: {"Symbian", "Palm OS", "Cisco IOS", "Debain"},
+		64:  {"Linux", "FreeBSD", "Centos", "Ubuntu", "Debain", "macOS", "iOS"},
+		128: {"Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
+		255: {"Symbian", "Palm OS", "Cisco IOS"},
 	},
 	"Win Size": {
-		8192:  {"Symbian", "Windows 7", "Windows XP", "Windows 10", "Windows 11"},
+		8192:  {"Symbian", "Windows 7", "Windows 8", "Windows XP", "Windows 10", "Windows 11", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
 		14600: {"Linux"},
 		16348: {"Palm OS"},
 		64240: {"Linux", "Ubuntu", "Centos"},
-		65392: {"Windows 10", "Windows 11", "Windows XP", "Windows 7"},
-		65535: {"FreeBSD", "Windows XP", "Windows 10", "Windows 11"},
+		65392: {"Windows 10", "Windows 11", "Windows XP", "Windows 7", "Windows 8"},
+		65535: {"FreeBSD", "Windows XP", "Windows 10", "Windows 11", "macOS", "iOS"},
 		65550: {"FreeBSD"},
 		29200: {"Centos"},
 		26883: {"Debain"},
-		0:     {"Linux", "FreeBSD", "Windows XP", "Windows 7", "Windows 10", "Windows 11", "Symbian", "Palm OS", "Centos", "Ubuntu", "Debain"},
+		0:     {"Linux", "FreeBSD", "Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11", "Symbian", "Palm OS", "Centos", "Ubuntu", "Debain", "Cisco IOS", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025", "macOS", "iOS"},
 	},
 	"MSS": {
 		1350: {"Palm OS"},
-		1440: {"Windows XP", "Windows 7", "Windows 10", "Windows 11"},
-		1460: {"Linux", "FreeBSD"},
+		1440: {"Windows XP", "Windows 7", "Windows 8", "Windows 10", "Windows 11", "Windows Server 2003", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
+		1460: {"Linux", "FreeBSD", "macOS", "iOS"},
 		1200: {"Centos", "Ubuntu", "Windows 7", "Debain"},
 	},
+	// 第一个SEQ探测（WS 10、NOP、MSS 1460、时间戳、SACK）对应SYN/ACK的TCP选项签名
+	"TCP Options": {
+		"M5B4ST11NW7":     {"Linux", "Centos", "Ubuntu", "Debain"},
+		"M5B4ST11NW6":     {"Linux", "Centos", "Ubuntu", "Debain"},
+		"M5B4ST11NW5":     {"Linux", "Centos"},
+		"M5B4ST11NW2":     {"Linux"},
+		"M5B4NW8ST11":     {"Windows 7", "Windows 8", "Windows 10", "Windows 11", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
+		"M5B4NW8NNS":      {"Windows 7", "Windows 8", "Windows 10", "Windows 11", "Windows Server 2008", "Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"},
+		"M5B4NW0NNT00NNS": {"Windows XP", "Windows Server 2003"},
+		"M5B4NW6ST11":     {"FreeBSD"},
+		"M5B4NW3ST11":     {"FreeBSD"},
+		"M5B4NW6NNT11SLL": {"macOS", "iOS"},
+		"M5B4NW5NNT11SLL": {"macOS", "iOS"},
+		"M5B4":            {"Cisco IOS", "Symbian", "Palm OS"},
+		"M218":            {"Cisco IOS"},
+	},
 }
 
 // CommonTCPPorts 定义常用的TCP端口
-var CommonTCPPorts = []int{22, 80, 443, 135, 139, 445, 1433, 1521, 3306, 3389, 6379, 7001, 8080}
+var CommonTCPPorts = []int{22, 80, 443, 135, 139, 445, 389, 1433, 1521, 3306, 3389, 5985, 5986, 6379, 7001, 8080}
+
+// DefaultSNMPCommunities 定义默认尝试的SNMP团体名
+var DefaultSNMPCommunities = []string{"public", "private"}
 
 // MaxRTT 定义最大往返时间（秒）
 const MaxRTT = 2
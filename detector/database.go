@@ -0,0 +1,585 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TDS 数据包类型和PRELOGIN选项
+const (
+	tdsPacketLogin7    = 0x10
+	tdsPacketPrelogin  = 0x12
+	tdsStatusEOM       = 0x01
+	tdsPreloginVersion = 0x00
+	tdsPreloginEncrypt = 0x01
+	tdsPreloginInstOpt = 0x02
+	tdsPreloginThread  = 0x03
+	tdsPreloginEnd     = 0xff
+	tdsEncryptNotSup   = 0x02
+	tdsEncryptReq      = 0x03
+	tdsVersion72       = 0x72090002
+	tdsLogin7HeaderLen = 94
+)
+
+// TNS 数据包类型
+const (
+	tnsPacketConnect = 1
+	tnsPacketAccept  = 2
+	tnsPacketRefuse  = 4
+)
+
+// mssqlProductNames SQL Server主版本号对应的产品名称
+var mssqlProductNames = map[int]string{
+	8:  "SQL Server 2000",
+	9:  "SQL Server 2005",
+	10: "SQL Server 2008",
+	11: "SQL Server 2012",
+	12: "SQL Server 2014",
+	13: "SQL Server 2016",
+	14: "SQL Server 2017",
+	15: "SQL Server 2019",
+	16: "SQL Server 2022",
+}
+
+var (
+	tnsPlatformPattern = regexp.MustCompile(`TNSLSNR for ([^:]+): Version ([\d.]+)`)
+	tnsVSNNUMPattern   = regexp.MustCompile(`VSNNUM=(\d+)`)
+)
+
+// MySQLInfo MySQL/MariaDB初始握手信息
+type MySQLInfo struct {
+	ProtocolVersion int
+	Version         string
+	AuthPlugin      string
+	Error           string // 服务器拒绝连接时返回的错误信息
+}
+
+// MSSQLInfo SQL Server PRELOGIN和NTLM信息
+type MSSQLInfo struct {
+	Version    string
+	Product    string
+	Encryption byte
+	NTLM       *NTLMChallengeInfo
+}
+
+// RedisInfo Redis INFO server中的版本和系统信息
+type RedisInfo struct {
+	Version string
+	OS      string
+	Mode    string
+	NoAuth  bool // 需要认证，无法读取INFO
+}
+
+// OracleInfo Oracle TNS监听器版本信息
+type OracleInfo struct {
+	Version  string
+	Platform string
+	VSNNUM   uint32
+}
+
+// MySQLFingerprint 通过MySQL初始握手中的版本字符串识别发行版
+func (d *OSDetector) MySQLFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "3306"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MySQL] Failed to connect: %v\n", err)
+		}
+		return resultSet
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	payload, err := mysqlReadPacket(conn)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MySQL] Failed to read handshake: %v\n", err)
+		}
+		return resultSet
+	}
+	info := parseMySQLHandshake(payload)
+	d.mysqlInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[MySQL] Protocol: %d, Version: %q, Auth plugin: %q, Error: %q\n",
+			info.ProtocolVersion, info.Version, info.AuthPlugin, info.Error)
+	}
+	if info.Version == "" {
+		return resultSet
+	}
+	d.addDetail("MySQL: %s", info.Version)
+
+	// 例如 "8.0.35-0ubuntu0.22.04.1"、"10.6.12-MariaDB-1:10.6.12+maria~deb11"、"5.5.68-MariaDB" (.el7)
+	resultSet = osSetFromVersionString(info.Version)
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+	if len(resultSet) > 0 {
+		log.Println("MySQL版本字符串包含发行版标记:", info.Version)
+	}
+
+	return resultSet
+}
+
+// MySQLInfo 返回MySQL握手信息，未探测或无响应时为nil
+func (d *OSDetector) MySQLInfo() *MySQLInfo {
+	return d.mysqlInfo
+}
+
+// mysqlReadPacket 读取一个MySQL协议数据包的负载
+func mysqlReadPacket(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length == 0 || length > 1<<16 {
+		return nil, fmt.Errorf("invalid MySQL packet length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// parseMySQLHandshake 解析HandshakeV10或错误包
+func parseMySQLHandshake(payload []byte) *MySQLInfo {
+	info := &MySQLInfo{ProtocolVersion: int(payload[0])}
+
+	// 0xff为错误包：错误码(2) + 消息
+	if payload[0] == 0xff {
+		if len(payload) > 3 {
+			info.Error = string(payload[3:])
+		}
+		return info
+	}
+
+	end := bytes.IndexByte(payload[1:], 0)
+	if end == -1 {
+		return info
+	}
+	info.Version = string(payload[1 : 1+end])
+
+	// 认证插件名位于握手包末尾，以NUL结尾
+	rest := payload[1+end+1:]
+	if i := bytes.LastIndexByte(bytes.TrimRight(rest, "\x00"), 0); i != -1 {
+		info.AuthPlugin = string(bytes.TrimRight(rest[i+1:], "\x00"))
+	}
+	return info
+}
+
+// MSSQLFingerprint 通过TDS PRELOGIN版本和LOGIN7中的NTLM Challenge识别SQL Server及Windows版本
+func (d *OSDetector) MSSQLFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "1433"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MSSQL] Failed to connect: %v\n", err)
+		}
+		return resultSet
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	info, err := mssqlPrelogin(conn)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MSSQL] PRELOGIN failed: %v\n", err)
+		}
+		return resultSet
+	}
+
+	// 声明不支持加密后，未强制加密的服务器允许明文发送LOGIN7
+	if info.Encryption != tdsEncryptReq {
+		info.NTLM = mssqlNTLMChallenge(conn)
+	}
+	d.mssqlInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[MSSQL] Version: %s (%s), Encryption: %d\n", info.Version, info.Product, info.Encryption)
+	}
+	d.addDetail("MSSQL: %s %s", info.Product, info.Version)
+
+	if info.NTLM != nil && info.NTLM.Version != nil {
+		return d.osSetFromNTLMChallenge("MSSQL", info.NTLM)
+	}
+
+	// SQL Server 2017之前只能运行在Windows上
+	major, _ := strconv.Atoi(strings.Split(info.Version, ".")[0])
+	if major > 0 && major < 14 {
+		resultSet = newOSSet(WindowsFamily)
+		for os := range resultSet {
+			d.osWeights[os] += 2
+		}
+		log.Println("SQL Server版本早于2017，目标为Windows系统:", info.Product)
+	}
+
+	return resultSet
+}
+
+// MSSQLInfo 返回SQL Server PRELOGIN信息，未探测或无响应时为nil
+func (d *OSDetector) MSSQLInfo() *MSSQLInfo {
+	return d.mssqlInfo
+}
+
+// tdsPacket 构造TDS数据包
+func tdsPacket(packetType byte, payload []byte) []byte {
+	packet := []byte{packetType, tdsStatusEOM}
+	packet = binary.BigEndian.AppendUint16(packet, uint16(8+len(payload)))
+	packet = append(packet, 0, 0, 1, 0) // SPID、PacketID、Window
+	return append(packet, payload...)
+}
+
+// tdsReadPacket 读取一个完整的TDS消息，合并多个数据包
+func tdsReadPacket(conn net.Conn) ([]byte, error) {
+	var message []byte
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:4]))
+		if length < 8 {
+			return nil, fmt.Errorf("invalid TDS packet length %d", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+		message = append(message, body...)
+		if header[1]&tdsStatusEOM != 0 {
+			return message, nil
+		}
+	}
+}
+
+// mssqlPrelogin 发送PRELOGIN并解析服务器版本和加密选项
+func mssqlPrelogin(conn net.Conn) (*MSSQLInfo, error) {
+	options := []struct {
+		token byte
+		data  []byte
+	}{
+		{tdsPreloginVersion, []byte{0, 0, 0, 0, 0, 0}},
+		{tdsPreloginEncrypt, []byte{tdsEncryptNotSup}},
+		{tdsPreloginInstOpt, []byte{0}},
+		{tdsPreloginThread, []byte{0, 0, 0, 0}},
+	}
+	var header, data []byte
+	offset := len(options)*5 + 1
+	for _, opt := range options {
+		header = append(header, opt.token)
+		header = binary.BigEndian.AppendUint16(header, uint16(offset+len(data)))
+		header = binary.BigEndian.AppendUint16(header, uint16(len(opt.data)))
+		data = append(data, opt.data...)
+	}
+	header = append(header, tdsPreloginEnd)
+
+	if _, err := conn.Write(tdsPacket(tdsPacketPrelogin, append(header, data...))); err != nil {
+		return nil, err
+	}
+	response, err := tdsReadPacket(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MSSQLInfo{}
+	found := false
+	for off := 0; off+5 <= len(response) && response[off] != tdsPreloginEnd; off += 5 {
+		start := int(binary.BigEndian.Uint16(response[off+1:]))
+		length := int(binary.BigEndian.Uint16(response[off+3:]))
+		if start+length > len(response) {
+			return nil, fmt.Errorf("invalid PRELOGIN option")
+		}
+		value := response[start : start+length]
+		switch response[off] {
+		case tdsPreloginVersion:
+			if length >= 6 {
+				found = true
+				info.Version = fmt.Sprintf("%d.%d.%d.%d", value[0], value[1],
+					binary.BigEndian.Uint16(value[2:4]), binary.BigEndian.Uint16(value[4:6]))
+				info.Product = mssqlProductNames[int(value[0])]
+			}
+		case tdsPreloginEncrypt:
+			if length >= 1 {
+				info.Encryption = value[0]
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no version in PRELOGIN response")
+	}
+	return info, nil
+}
+
+// mssqlNTLMChallenge 发送使用集成认证的LOGIN7，读取SSPI令牌中的NTLM Challenge
+func mssqlNTLMChallenge(conn net.Conn) *NTLMChallengeInfo {
+	sspi := ntlmNegotiateMessage()
+
+	login := make([]byte, tdsLogin7HeaderLen)
+	binary.LittleEndian.PutUint32(login[0:], uint32(tdsLogin7HeaderLen+len(sspi)))
+	binary.LittleEndian.PutUint32(login[4:], tdsVersion72)
+	binary.LittleEndian.PutUint32(login[8:], 4096) // PacketSize
+	login[24] = 0xe0                               // OptionFlags1
+	login[25] = 0x83                               // OptionFlags2：fIntSecurity
+	// HostName到Database的9个偏移/长度字段均指向数据区起始位置且长度为0
+	for i := 0; i < 9; i++ {
+		binary.LittleEndian.PutUint16(login[36+i*4:], tdsLogin7HeaderLen)
+	}
+	binary.LittleEndian.PutUint16(login[78:], tdsLogin7HeaderLen) // SSPI
+	binary.LittleEndian.PutUint16(login[80:], uint16(len(sspi)))
+	binary.LittleEndian.PutUint16(login[82:], uint16(tdsLogin7HeaderLen+len(sspi))) // AtchDBFile
+	binary.LittleEndian.PutUint16(login[86:], uint16(tdsLogin7HeaderLen+len(sspi))) // ChangePassword
+	login = append(login, sspi...)
+
+	if _, err := conn.Write(tdsPacket(tdsPacketLogin7, login)); err != nil {
+		return nil
+	}
+	response, err := tdsReadPacket(conn)
+	if err != nil {
+		return nil
+	}
+	challenge, err := parseNTLMChallenge(response)
+	if err != nil {
+		return nil
+	}
+	return challenge
+}
+
+// RedisFingerprint 通过Redis INFO server中的os字段识别操作系统
+func (d *OSDetector) RedisFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "6379"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Redis] Failed to connect: %v\n", err)
+		}
+		return resultSet
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	if _, err := conn.Write([]byte("INFO server\r\n")); err != nil {
+		return resultSet
+	}
+	info, err := readRedisInfo(bufio.NewReader(conn))
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Redis] Failed to read INFO: %v\n", err)
+		}
+		return resultSet
+	}
+	d.redisInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[Redis] Version: %s, OS: %q, Mode: %s, NoAuth: %v\n", info.Version, info.OS, info.Mode, info.NoAuth)
+	}
+	fields := strings.Fields(info.OS)
+	if len(fields) == 0 {
+		return resultSet
+	}
+	d.addDetail("Redis: %s on %s", info.Version, info.OS)
+
+	// 例如 "Linux 5.15.0-91-generic x86_64"、"FreeBSD 13.2-RELEASE amd64"、"Windows"
+	switch strings.ToLower(fields[0]) {
+	case "linux":
+		if len(fields) > 1 {
+			resultSet = osSetFromLinuxKernel(fields[1])
+		} else {
+			resultSet = newOSSet(LinuxFamily)
+		}
+	case "freebsd":
+		resultSet["FreeBSD"] = true
+	case "windows":
+		resultSet = newOSSet(WindowsFamily)
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+	if len(resultSet) > 0 {
+		log.Println("Redis INFO显示目标系统为:", info.OS)
+	}
+
+	return resultSet
+}
+
+// RedisInfo 返回Redis INFO信息，未探测或无响应时为nil
+func (d *OSDetector) RedisInfo() *RedisInfo {
+	return d.redisInfo
+}
+
+// readRedisInfo 读取INFO命令的批量字符串回复
+func readRedisInfo(reader *bufio.Reader) (*RedisInfo, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSpace(line)
+
+	info := &RedisInfo{}
+	switch {
+	case strings.HasPrefix(line, "-"):
+		// -NOAUTH Authentication required.
+		info.NoAuth = strings.Contains(line, "NOAUTH")
+		return info, nil
+	case !strings.HasPrefix(line, "$"):
+		return nil, fmt.Errorf("unexpected Redis reply %q", line)
+	}
+
+	length, err := strconv.Atoi(line[1:])
+	if err != nil || length < 0 || length > 1<<16 {
+		return nil, fmt.Errorf("invalid bulk length %q", line)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	for _, field := range strings.Split(string(body), "\r\n") {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "redis_version":
+			info.Version = value
+		case "os":
+			info.OS = value
+		case "redis_mode":
+			info.Mode = value
+		}
+	}
+	return info, nil
+}
+
+// OracleFingerprint 通过TNS监听器的VERSION命令识别Oracle版本和平台
+func (d *OSDetector) OracleFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "1521"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Oracle] Failed to connect: %v\n", err)
+		}
+		return resultSet
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	if _, err := conn.Write(tnsConnectPacket("(CONNECT_DATA=(COMMAND=version))")); err != nil {
+		return resultSet
+	}
+	response, err := tnsReadPacket(conn)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Oracle] No TNS response: %v\n", err)
+		}
+		return resultSet
+	}
+
+	info := parseTNSVersion(response)
+	if info == nil {
+		return resultSet
+	}
+	d.oracleInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[Oracle] Version: %s, Platform: %q, VSNNUM: %d\n", info.Version, info.Platform, info.VSNNUM)
+	}
+	d.addDetail("Oracle TNS: %s %s", info.Version, info.Platform)
+
+	switch {
+	case containsIgnoreCase(info.Platform, "windows"):
+		resultSet = newOSSet(WindowsFamily)
+	case containsIgnoreCase(info.Platform, "linux"):
+		resultSet = newOSSet(LinuxFamily)
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 2
+	}
+	if len(resultSet) > 0 {
+		log.Println("Oracle TNS监听器平台为:", info.Platform)
+	}
+
+	return resultSet
+}
+
+// OracleInfo 返回Oracle TNS监听器信息，未探测或无响应时为nil
+func (d *OSDetector) OracleInfo() *OracleInfo {
+	return d.oracleInfo
+}
+
+// parseTNSVersion 从TNS监听器响应中提取版本和平台，两者都没有时返回nil
+func parseTNSVersion(response []byte) *OracleInfo {
+	info := &OracleInfo{}
+	// 较早的版本直接返回 "TNSLSNR for Linux: Version 11.2.0.4.0 - Production"
+	if m := tnsPlatformPattern.FindSubmatch(response); m != nil {
+		info.Platform = string(m[1])
+		info.Version = string(m[2])
+	}
+	// 10g之后通常拒绝远程VERSION命令，但错误信息中仍包含VSNNUM
+	if m := tnsVSNNUMPattern.FindSubmatch(response); m != nil {
+		vsnnum, _ := strconv.ParseUint(string(m[1]), 10, 32)
+		info.VSNNUM = uint32(vsnnum)
+		if info.Version == "" {
+			v := info.VSNNUM
+			info.Version = fmt.Sprintf("%d.%d.%d.%d.%d", v>>24, v>>20&0x0f, v>>12&0xff, v>>8&0x0f, v&0xff)
+		}
+	}
+	if info.Version == "" && info.Platform == "" {
+		return nil
+	}
+	return info
+}
+
+// tnsConnectPacket 构造携带连接描述符的TNS CONNECT数据包
+func tnsConnectPacket(connectData string) []byte {
+	const dataOffset = 58
+
+	packet := make([]byte, dataOffset, dataOffset+len(connectData))
+	binary.BigEndian.PutUint16(packet[0:], uint16(dataOffset+len(connectData)))
+	packet[4] = tnsPacketConnect
+	binary.BigEndian.PutUint16(packet[8:], 0x0136)  // 版本
+	binary.BigEndian.PutUint16(packet[10:], 0x012c) // 最低兼容版本
+	binary.BigEndian.PutUint16(packet[14:], 0x0800) // SDU
+	binary.BigEndian.PutUint16(packet[16:], 0x7fff) // TDU
+	binary.BigEndian.PutUint16(packet[18:], 0x7f08) // NT协议特征
+	binary.BigEndian.PutUint16(packet[22:], 0x0100) // 硬件字节序中的1
+	binary.BigEndian.PutUint16(packet[24:], uint16(len(connectData)))
+	binary.BigEndian.PutUint16(packet[26:], dataOffset)
+	packet[32] = 0x41 // 连接标志
+	packet[33] = 0x41
+	return append(packet, connectData...)
+}
+
+// tnsReadPacket 读取一个TNS数据包，只接受ACCEPT和REFUSE
+func tnsReadPacket(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[0:2]))
+	if length < 8 {
+		return nil, fmt.Errorf("invalid TNS packet length %d", length)
+	}
+	if header[4] != tnsPacketAccept && header[4] != tnsPacketRefuse {
+		return nil, fmt.Errorf("unexpected TNS packet type %d", header[4])
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
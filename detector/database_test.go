@@ -0,0 +1,59 @@
+package detector
+
+import "testing"
+
+func TestParseTNSVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		version  string
+		platform string
+		vsnnum   uint32
+	}{
+		{
+			name:     "VERSION banner",
+			response: "(DESCRIPTION=(TMP=)(VSNNUM=186647552)(ERR=0))TNSLSNR for Linux: Version 11.2.0.4.0 - Production",
+			version:  "11.2.0.4.0",
+			platform: "Linux",
+			vsnnum:   186647552,
+		},
+		{
+			// 12c拒绝远程VERSION命令，只能从VSNNUM解码版本
+			name:     "12.1.0.2 refused",
+			response: "(DESCRIPTION=(TMP=)(VSNNUM=202375680)(ERR=1189)(ERROR_STACK=(ERROR=(CODE=1189)(EMFI=4))))",
+			version:  "12.1.0.2.0",
+			vsnnum:   202375680,
+		},
+		{
+			name:     "19c refused",
+			response: "(DESCRIPTION=(TMP=)(VSNNUM=318767104)(ERR=1189))",
+			version:  "19.0.0.0.0",
+			vsnnum:   318767104,
+		},
+		{
+			name:     "Windows banner",
+			response: "TNSLSNR for 64-bit Windows: Version 11.2.0.1.0 - Production",
+			version:  "11.2.0.1.0",
+			platform: "64-bit Windows",
+		},
+		{name: "no version", response: "(DESCRIPTION=(ERR=12514))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseTNSVersion([]byte(tt.response))
+			if tt.version == "" {
+				if info != nil {
+					t.Fatalf("parseTNSVersion() = %+v, want nil", info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatal("parseTNSVersion() = nil")
+			}
+			if info.Version != tt.version || info.Platform != tt.platform || info.VSNNUM != tt.vsnnum {
+				t.Errorf("parseTNSVersion() = %+v, want Version=%s Platform=%q VSNNUM=%d", info, tt.version, tt.platform, tt.vsnnum)
+			}
+		})
+	}
+}
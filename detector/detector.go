@@ -1,18 +1,62 @@
 package detector
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"slices"
+	"strconv"
+	"syscall"
 	"time"
 )
 
 type OSDetector struct {
-	Verbose          bool
-	lastCheckedPort  int            // 记录最后检查的端口号
-	osWeights        map[string]int // 操作系统权重表
-	detectionDetails []string
-	smbVersion       *NTLMSSPVersion // 添加SMB版本信息字段
+	Verbose             bool
+	NTPControlQueries   bool           // 是否发送NTP mode 6/7控制查询
+	SNMPCommunities     []string       // SNMP探测使用的团体名列表
+	BannerSignatureFile string         // 自定义Banner签名文件，为空时使用内置签名
+	DisableDNS          bool           // 禁用正向和反向DNS解析
+	DNSServer           string         // 自定义DNS服务器，为空时使用系统解析器
+	TracerouteMethod    string         // 检测前测量跳数的traceroute方式（icmp、udp、tcp），为空时不执行
+	lastCheckedPort     int            // 记录最后检查的端口号
+	osWeights           map[string]int // 操作系统权重表
+	detectionDetails    []string
+	securityFindings    []string
+	smbVersion          *NTLMSSPVersion       // 添加SMB版本信息字段
+	dnsInfo             *DNSServerInfo        // DNS服务器指纹信息
+	ntpInfo             *NTPServerInfo        // NTP服务器指纹信息
+	snmpInfo            *SNMPInfo             // SNMP系统信息
+	netbiosInfo         *NetBIOSInfo          // NetBIOS节点状态信息
+	rdpInfo             *RDPInfo              // RDP协商信息
+	msrpcInfo           *MSRPCInfo            // RPC端点映射器信息
+	winrmInfo           *WinRMInfo            // WS-Management服务信息
+	ldapInfo            *LDAPRootDSEInfo      // LDAP rootDSE信息
+	kerberosInfo        *KerberosInfo         // Kerberos KDC错误响应信息
+	bannerMatches       []*BannerMatch        // Banner签名匹配结果
+	mysqlInfo           *MySQLInfo            // MySQL握手信息
+	mssqlInfo           *MSSQLInfo            // SQL Server PRELOGIN信息
+	redisInfo           *RedisInfo            // Redis INFO信息
+	oracleInfo          *OracleInfo           // Oracle TNS监听器信息
+	middlewareInfo      *MiddlewareInfo       // Java中间件信息
+	ssdpInfo            *SSDPInfo             // UPnP设备信息
+	mdnsInfo            *MDNSInfo             // mDNS/DNS-SD信息
+	llmnrInfo           *LLMNRInfo            // LLMNR响应信息
+	wsdInfo             *WSDInfo              // WS-Discovery响应和设备元数据
+	seqResponses        []*tcpResponse        // SEQ探测得到的SYN/ACK响应
+	seqCollected        bool                  // 是否已发送SEQ探测
+	isnAnalysis         *ISNAnalysis          // TCP初始序列号分析结果
+	tcpTestResults      []*TCPTestResult      // T2-T7探测结果
+	tcpTestsCollected   bool                  // 是否已发送T2-T7探测
+	u1Result            *U1Result             // ICMP端口不可达分析结果
+	ieResult            *IEResult             // ICMP回显变体测试结果
+	ieCollected         bool                  // 是否已发送ICMP回显变体探测
+	icmpLegacyResult    *ICMPLegacyResult     // ICMP时间戳、信息请求和地址掩码请求结果
+	ecnResult           *ECNResult            // ECN协商探测结果
+	tracerouteResult    *TracerouteResult     // traceroute结果
+	hopDistance         int                   // 到目标的跳数，未知时为0
+	ipidAnalysis        *IPIDAnalysis         // IP ID序列分析结果
+	timestampAnalysis   *TCPTimestampAnalysis // TCP时间戳分析结果
 }
 
 func NewOSDetector(verbose bool) *OSDetector {
@@ -22,8 +66,9 @@ func NewOSDetector(verbose bool) *OSDetector {
 		osWeights[os] = 0
 	}
 	return &OSDetector{
-		Verbose:   verbose,
-		osWeights: osWeights,
+		Verbose:         verbose,
+		SNMPCommunities: DefaultSNMPCommunities,
+		osWeights:       osWeights,
 	}
 }
 
@@ -39,6 +84,15 @@ func (d *OSDetector) DetectOS(targetIP string, isPing bool) string {
 	for _, os := range AllOS {
 		d.osWeights[os] = 0
 	}
+	d.detectionDetails = nil
+	d.securityFindings = nil
+
+	// 先测量跳数，TTL分析据此还原初始TTL
+	if d.TracerouteMethod != "" && d.tracerouteResult == nil {
+		if _, err := d.Traceroute(targetIP, d.TracerouteMethod); err != nil {
+			log.Println("traceroute失败：", err)
+		}
+	}
 
 	// 使用多种方法进行检测
 	detectionMethods := []struct {
@@ -49,10 +103,35 @@ func (d *OSDetector) DetectOS(targetIP string, isPing bool) string {
 		{"TCP", (*OSDetector).TestOSUsingTCP},
 		{"SMB", (*OSDetector).TestOSUsingSMB},
 		{"TCP Stack", (*OSDetector).TCPStackFingerprint},
+		{"ISN", (*OSDetector).ISNFingerprint},
+		{"IP ID", (*OSDetector).IPIDFingerprint},
+		{"TCP Timestamp", (*OSDetector).TCPTimestampFingerprint},
+		{"TCP Tests", (*OSDetector).TCPTestsFingerprint},
+		{"ECN", (*OSDetector).ECNFingerprint},
+		{"U1", (*OSDetector).U1Fingerprint},
+		{"ICMP IE", (*OSDetector).ICMPEchoVariantsFingerprint},
+		{"ICMP Legacy", (*OSDetector).ICMPLegacyFingerprint},
 		{"HTTP", (*OSDetector).HTTPFingerprint},
 		{"SSH", (*OSDetector).SSHFingerprint},
 		{"DNS", (*OSDetector).DNSFingerprint},
 		{"NTP", (*OSDetector).NTPFingerprint},
+		{"SNMP", (*OSDetector).SNMPFingerprint},
+		{"NetBIOS", (*OSDetector).NetBIOSFingerprint},
+		{"RDP", (*OSDetector).RDPFingerprint},
+		{"MSRPC", (*OSDetector).MSRPCFingerprint},
+		{"WinRM", (*OSDetector).WinRMFingerprint},
+		{"LDAP", (*OSDetector).LDAPFingerprint},
+		{"Kerberos", (*OSDetector).KerberosFingerprint},
+		{"Banner", (*OSDetector).BannerFingerprint},
+		{"MySQL", (*OSDetector).MySQLFingerprint},
+		{"MSSQL", (*OSDetector).MSSQLFingerprint},
+		{"Redis", (*OSDetector).RedisFingerprint},
+		{"Oracle", (*OSDetector).OracleFingerprint},
+		{"Middleware", (*OSDetector).MiddlewareFingerprint},
+		{"SSDP", (*OSDetector).SSDPFingerprint},
+		{"mDNS", (*OSDetector).MDNSFingerprint},
+		{"LLMNR", (*OSDetector).LLMNRFingerprint},
+		{"WS-Discovery", (*OSDetector).WSDFingerprint},
 	}
 
 	// 执行所有检测方法
@@ -98,7 +177,7 @@ func (d *OSDetector) DetectOS(targetIP string, isPing bool) string {
 func (d *OSDetector) defaultOSDetection(targetIP string) string {
 	// 检查常见端口
 	for _, port := range CommonTCPPorts {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", targetIP, port), time.Duration(MaxRTT)*time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, strconv.Itoa(port)), time.Duration(MaxRTT)*time.Second)
 		if err == nil {
 			conn.Close()
 			switch port {
@@ -125,9 +204,27 @@ func (d *OSDetector) printDetectionDetails(targetIP string, resultSet map[string
 	fmt.Printf("目标IP: %s\n", targetIP)
 	fmt.Printf("可能的操作系统: %v\n", d.formatOSSet(resultSet))
 	fmt.Printf("最终判定: %s\n", finalResult)
+	for _, detail := range d.detectionDetails {
+		fmt.Printf("  - %s\n", detail)
+	}
 	fmt.Println("----------------------------------------")
 }
 
+// addDetail 记录一条检测证据，在详细模式下随检测详情输出
+func (d *OSDetector) addDetail(format string, args ...interface{}) {
+	d.detectionDetails = append(d.detectionDetails, fmt.Sprintf(format, args...))
+}
+
+// addFinding 记录检测过程中发现的安全问题
+func (d *OSDetector) addFinding(format string, args ...interface{}) {
+	d.securityFindings = append(d.securityFindings, fmt.Sprintf(format, args...))
+}
+
+// SecurityFindings 返回检测过程中发现的安全问题
+func (d *OSDetector) SecurityFindings() []string {
+	return d.securityFindings
+}
+
 // hasWindowsICMPFeatures 检查ICMP响应是否具有Windows系统特征
 func (d *OSDetector) hasWindowsICMPFeatures(targetIP string) bool {
 	// 获取ICMP响应
@@ -140,9 +237,9 @@ func (d *OSDetector) hasWindowsICMPFeatures(targetIP string) bool {
 	df, ttl := d.getIPParameters(icmpReply)
 
 	// 检查Windows特征
-	// 1. TTL值接近128（Windows系统的特征）
+	// 1. 初始TTL可能为128（Windows系统的特征）
 	// 2. DF标志通常被设置（Windows系统特征）
-	hasWindowsFeatures := (ttl > 64 && ttl <= 128) || df
+	hasWindowsFeatures := slices.Contains(d.initialTTLCandidates(ttl), 128) || df
 
 	return hasWindowsFeatures
 }
@@ -164,13 +261,35 @@ func (d *OSDetector) SurvivalDetect(targetIP string) (bool, bool) {
 
 	// 如果ICMP检测失败，尝试TCP端口扫描
 	for _, port := range CommonTCPPorts {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", targetIP, port), time.Duration(MaxRTT)*time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, strconv.Itoa(port)), time.Duration(MaxRTT)*time.Second)
 		if err == nil {
 			conn.Close()
 			isAlive = true
 			log.Printf("目标主机端口 %d 开放，确认存活\n", port)
 			break
 		}
+		// 关闭端口回复RST同样说明主机存活，后续可以使用关闭端口探测
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			isAlive = true
+			log.Printf("目标主机端口 %d 回复RST，确认存活\n", port)
+			break
+		}
+	}
+	if isAlive {
+		return isAlive, isPing
+	}
+
+	// 丢弃所有TCP的Windows客户端通常仍响应LLMNR和WS-Discovery
+	if info, err := d.llmnrProbe(targetIP); err == nil {
+		d.llmnrInfo = info
+		isAlive = true
+		log.Println("目标主机响应LLMNR查询，确认存活")
+		return isAlive, isPing
+	}
+	if info, err := wsdProbe(targetIP); err == nil {
+		d.wsdInfo = info
+		isAlive = true
+		log.Println("目标主机响应WS-Discovery探测，确认存活")
 	}
 
 	return isAlive, isPing
@@ -0,0 +1,451 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// DNS 记录类型与类别
+const (
+	dnsTypeA     = 1
+	dnsTypeSOA   = 6
+	dnsTypePTR   = 12
+	dnsTypeHINFO = 13
+	dnsTypeTXT   = 16
+	dnsTypeOPT   = 41
+
+	dnsClassIN = 1
+	dnsClassCH = 3
+)
+
+// DNS 操作码与标志位
+const (
+	dnsOpcodeQuery  = 0
+	dnsOpcodeIQuery = 1
+	dnsOpcodeNotify = 4
+
+	dnsFlagQR = 0x8000
+	dnsFlagRD = 0x0100
+
+	dnsEDNSOptionNSID = 3
+)
+
+// dnsRcodeNames DNS响应码名称（包含EDNS扩展响应码）
+var dnsRcodeNames = map[int]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	9:  "NOTAUTH",
+	16: "BADVERS",
+}
+
+// bindVersionPattern 未标注软件名称的BIND版本号，例如 "9.16.1-Ubuntu"
+var bindVersionPattern = regexp.MustCompile(`^9\.\d+\.\d+`)
+
+// DNSServerInfo DNS服务器指纹信息
+type DNSServerInfo struct {
+	Software  string            // BIND、Unbound、dnsmasq、Microsoft DNS、PowerDNS
+	Version   string            // version.bind 返回的版本字符串
+	Hostname  string            // hostname.bind 返回的主机名
+	ServerID  string            // id.server 或 EDNS NSID
+	EDNS      bool              // 是否支持EDNS0
+	UDPSize   uint16            // EDNS通告的UDP负载大小
+	Behaviors map[string]string // 各探测报文对应的响应码
+}
+
+// dnsQuery DNS查询参数
+type dnsQuery struct {
+	Opcode   int
+	Flags    uint16 // 附加标志位，与Opcode合并
+	Name     string
+	Type     uint16
+	Class    uint16
+	EDNS     int  // -1表示不携带OPT记录，否则为EDNS版本号
+	Truncate bool // 声明QDCOUNT=1但不携带问题段
+}
+
+// dnsRR DNS资源记录
+type dnsRR struct {
+	Type   uint16
+	Class  uint16
+	Data   []byte
+	msg    []byte // 完整报文，用于解析RDATA中的压缩域名
+	offset int    // RDATA在报文中的偏移量
+}
+
+// dnsMessage 解析后的DNS响应
+type dnsMessage struct {
+	ID          uint16
+	Flags       uint16
+	Rcode       int
+	Answers     []dnsRR
+	HasOPT      bool
+	UDPSize     uint16
+	EDNSVersion uint8
+	NSID        string
+}
+
+// dnsBehaviorProbes 参考fpdns的畸形查询行为测试
+var dnsBehaviorProbes = []struct {
+	name  string
+	query dnsQuery
+}{
+	{"iquery", dnsQuery{Opcode: dnsOpcodeIQuery, Name: ".", Type: dnsTypeSOA, Class: dnsClassIN, EDNS: -1}},
+	{"notify", dnsQuery{Opcode: dnsOpcodeNotify, Name: ".", Type: dnsTypeSOA, Class: dnsClassIN, EDNS: -1}},
+	{"truncated", dnsQuery{Opcode: dnsOpcodeQuery, Flags: dnsFlagRD, Truncate: true, EDNS: -1}},
+	{"edns1", dnsQuery{Opcode: dnsOpcodeQuery, Flags: dnsFlagRD, Name: ".", Type: dnsTypeSOA, Class: dnsClassIN, EDNS: 1}},
+}
+
+// dnsBehaviorSignatures 各DNS实现对行为测试的典型响应，仅在版本字符串缺失时作为辅助判断
+var dnsBehaviorSignatures = []struct {
+	software  string
+	behaviors map[string]string
+}{
+	{"BIND", map[string]string{"iquery": "NOTIMP", "notify": "NOTAUTH", "edns1": "BADVERS"}},
+	{"Unbound", map[string]string{"iquery": "NOTIMP", "notify": "REFUSED", "edns1": "BADVERS"}},
+	{"PowerDNS", map[string]string{"iquery": "NOTIMP", "notify": "REFUSED", "edns1": "BADVERS", "truncated": "none"}},
+	{"dnsmasq", map[string]string{"notify": "REFUSED", "edns1": "NOERROR"}},
+	{"Microsoft DNS", map[string]string{"iquery": "NOTIMP", "edns1": "FORMERR"}},
+}
+
+// DNSFingerprint 通过DNS查询特征识别操作系统
+func (d *OSDetector) DNSFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+	info := &DNSServerInfo{Behaviors: make(map[string]string)}
+
+	// 查询CHAOS TXT version.bind，没有响应说明目标未提供DNS服务
+	msg, err := d.dnsExchange(targetIP, dnsQuery{Name: "version.bind", Type: dnsTypeTXT, Class: dnsClassCH, EDNS: -1})
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[DNS] No response: %v\n", err)
+		}
+		return resultSet
+	}
+	info.Version = msg.txt()
+	info.Behaviors["version.bind"] = dnsRcodeName(msg.Rcode)
+
+	// 查询hostname.bind和id.server
+	if msg, err := d.dnsExchange(targetIP, dnsQuery{Name: "hostname.bind", Type: dnsTypeTXT, Class: dnsClassCH, EDNS: -1}); err == nil {
+		info.Hostname = msg.txt()
+	}
+	if msg, err := d.dnsExchange(targetIP, dnsQuery{Name: "id.server", Type: dnsTypeTXT, Class: dnsClassCH, EDNS: -1}); err == nil {
+		info.ServerID = msg.txt()
+	}
+
+	// EDNS0查询，同时请求NSID
+	if msg, err := d.dnsExchange(targetIP, dnsQuery{Flags: dnsFlagRD, Name: ".", Type: dnsTypeSOA, Class: dnsClassIN, EDNS: 0}); err == nil && msg.HasOPT {
+		info.EDNS = true
+		info.UDPSize = msg.UDPSize
+		if info.ServerID == "" {
+			info.ServerID = msg.NSID
+		}
+	}
+
+	// 畸形查询行为测试
+	for _, probe := range dnsBehaviorProbes {
+		msg, err := d.dnsExchange(targetIP, probe.query)
+		if err != nil {
+			info.Behaviors[probe.name] = "none"
+		} else {
+			info.Behaviors[probe.name] = dnsRcodeName(msg.Rcode)
+		}
+	}
+
+	info.Software = identifyDNSSoftware(info)
+	d.dnsInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[DNS] Software: %s, Version: %q, Hostname: %q, ID: %q, EDNS: %v (UDP size %d)\n",
+			info.Software, info.Version, info.Hostname, info.ServerID, info.EDNS, info.UDPSize)
+		fmt.Printf("[DNS] Behaviors: %v\n", info.Behaviors)
+	}
+	if info.Software == "" {
+		return resultSet
+	}
+	d.addDetail("DNS: %s %s", info.Software, info.Version)
+
+	// 版本字符串中的发行版标记优先
+	resultSet = osSetFromVersionString(info.Version)
+	if len(resultSet) > 0 {
+		for os := range resultSet {
+			d.osWeights[os] += 3
+		}
+		log.Println("DNS版本字符串包含发行版信息:", info.Version)
+		return resultSet
+	}
+
+	switch info.Software {
+	case "Microsoft DNS":
+		resultSet = newOSSet(WindowsFamily)
+		log.Println("检测到Microsoft DNS服务器，可能是Windows系统")
+	case "dnsmasq":
+		resultSet = newOSSet(LinuxFamily)
+	default:
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+	}
+	for os := range resultSet {
+		d.osWeights[os]++
+	}
+
+	return resultSet
+}
+
+// DNSServerInfo 返回DNS服务器指纹信息，未探测或无响应时为nil
+func (d *OSDetector) DNSServerInfo() *DNSServerInfo {
+	return d.dnsInfo
+}
+
+// identifyDNSSoftware 根据版本字符串、EDNS特征和行为测试识别DNS服务器软件
+func identifyDNSSoftware(info *DNSServerInfo) string {
+	v := strings.ToLower(info.Version)
+	switch {
+	case strings.Contains(v, "dnsmasq"):
+		return "dnsmasq"
+	case strings.Contains(v, "unbound"):
+		return "Unbound"
+	case strings.Contains(v, "powerdns"):
+		return "PowerDNS"
+	case strings.Contains(v, "microsoft"):
+		return "Microsoft DNS"
+	case strings.Contains(v, "bind") || bindVersionPattern.MatchString(info.Version):
+		return "BIND"
+	}
+
+	// Windows DNS服务器固定通告4000字节的EDNS负载
+	if info.UDPSize == 4000 {
+		return "Microsoft DNS"
+	}
+
+	best, bestScore := "", 0
+	for _, sig := range dnsBehaviorSignatures {
+		score := 0
+		for probe, want := range sig.behaviors {
+			if info.Behaviors[probe] != want {
+				score = -1
+				break
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = sig.software, score
+		}
+	}
+
+	return best
+}
+
+// dnsExchange 发送一个DNS查询并解析响应
+func (d *OSDetector) dnsExchange(targetIP string, q dnsQuery) (*dnsMessage, error) {
+	id := uint16(rand.Intn(0x10000))
+	resp, err := udpExchange(targetIP, 53, q.marshal(id))
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSMessage(resp, id)
+}
+
+// marshal 序列化DNS查询
+func (q dnsQuery) marshal(id uint16) []byte {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:2], id)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(q.Opcode&0x0f)<<11|q.Flags)
+	binary.BigEndian.PutUint16(msg[4:6], 1) // QDCOUNT=1
+	if q.Truncate {
+		return msg
+	}
+
+	for _, label := range strings.Split(strings.Trim(q.Name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, q.Type)
+	msg = binary.BigEndian.AppendUint16(msg, q.Class)
+
+	if q.EDNS >= 0 {
+		binary.BigEndian.PutUint16(msg[10:12], 1) // ARCOUNT=1
+		msg = append(msg, 0)                      // 根域名
+		msg = binary.BigEndian.AppendUint16(msg, dnsTypeOPT)
+		msg = binary.BigEndian.AppendUint16(msg, 4096) // UDP负载大小
+		msg = append(msg, 0, byte(q.EDNS), 0, 0)       // 扩展响应码、版本、DO/Z
+		msg = binary.BigEndian.AppendUint16(msg, 4)
+		msg = binary.BigEndian.AppendUint16(msg, dnsEDNSOptionNSID)
+		msg = binary.BigEndian.AppendUint16(msg, 0)
+	}
+
+	return msg
+}
+
+// parseDNSMessage 解析DNS响应
+func parseDNSMessage(data []byte, id uint16) (*dnsMessage, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("DNS response too short")
+	}
+
+	msg := &dnsMessage{
+		ID:    binary.BigEndian.Uint16(data[0:2]),
+		Flags: binary.BigEndian.Uint16(data[2:4]),
+	}
+	if msg.ID != id {
+		return nil, fmt.Errorf("unexpected DNS ID %#04x", msg.ID)
+	}
+	if msg.Flags&dnsFlagQR == 0 {
+		return nil, fmt.Errorf("not a DNS response")
+	}
+	msg.Rcode = int(msg.Flags & 0x0f)
+
+	qdCount := int(binary.BigEndian.Uint16(data[4:6]))
+	anCount := int(binary.BigEndian.Uint16(data[6:8]))
+	rrCount := anCount + int(binary.BigEndian.Uint16(data[8:10])) + int(binary.BigEndian.Uint16(data[10:12]))
+
+	off := 12
+	var err error
+	for i := 0; i < qdCount; i++ {
+		if off, err = skipDNSName(data, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+
+	for i := 0; i < rrCount; i++ {
+		if off, err = skipDNSName(data, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(data) {
+			return nil, fmt.Errorf("truncated DNS record")
+		}
+		rr := dnsRR{
+			Type:  binary.BigEndian.Uint16(data[off:]),
+			Class: binary.BigEndian.Uint16(data[off+2:]),
+		}
+		ttl := binary.BigEndian.Uint32(data[off+4:])
+		rdLen := int(binary.BigEndian.Uint16(data[off+8:]))
+		off += 10
+		if off+rdLen > len(data) {
+			return nil, fmt.Errorf("truncated DNS record data")
+		}
+		rr.Data = data[off : off+rdLen]
+		rr.msg = data
+		rr.offset = off
+		off += rdLen
+
+		if rr.Type == dnsTypeOPT {
+			// OPT记录的Class为UDP负载大小，TTL高位为扩展响应码和版本
+			msg.HasOPT = true
+			msg.UDPSize = rr.Class
+			msg.Rcode |= int(ttl>>24) << 4
+			msg.EDNSVersion = uint8(ttl >> 16)
+			msg.NSID = parseEDNSNSID(rr.Data)
+		} else if i < anCount {
+			msg.Answers = append(msg.Answers, rr)
+		}
+	}
+
+	return msg, nil
+}
+
+// skipDNSName 跳过报文中的域名，返回域名之后的偏移量
+func skipDNSName(data []byte, off int) (int, error) {
+	for off < len(data) {
+		length := int(data[off])
+		switch {
+		case length == 0:
+			return off + 1, nil
+		case length&0xc0 == 0xc0:
+			return off + 2, nil
+		default:
+			off += length + 1
+		}
+	}
+	return 0, fmt.Errorf("malformed DNS name")
+}
+
+// readDNSName 读取报文中可能经过压缩的域名
+func readDNSName(data []byte, off int) (string, error) {
+	var labels []string
+	for jumps := 0; off < len(data); {
+		length := int(data[off])
+		switch {
+		case length == 0:
+			return strings.Join(labels, "."), nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(data) || jumps > 16 {
+				return "", fmt.Errorf("malformed DNS name")
+			}
+			off = int(binary.BigEndian.Uint16(data[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(data) {
+				return "", fmt.Errorf("malformed DNS name")
+			}
+			labels = append(labels, string(data[off+1:off+1+length]))
+			off += length + 1
+		}
+	}
+	return "", fmt.Errorf("malformed DNS name")
+}
+
+// name 解析PTR等记录RDATA中的域名
+func (rr dnsRR) name() (string, error) {
+	return readDNSName(rr.msg, rr.offset)
+}
+
+// parseEDNSNSID 从OPT记录中提取NSID选项
+func parseEDNSNSID(data []byte) string {
+	for off := 0; off+4 <= len(data); {
+		code := binary.BigEndian.Uint16(data[off:])
+		length := int(binary.BigEndian.Uint16(data[off+2:]))
+		off += 4
+		if off+length > len(data) {
+			break
+		}
+		if code == dnsEDNSOptionNSID {
+			return string(data[off : off+length])
+		}
+		off += length
+	}
+	return ""
+}
+
+// txt 拼接应答段中的TXT记录
+func (m *dnsMessage) txt() string {
+	return strings.Join(m.txtStrings(), " ")
+}
+
+// txtStrings 返回应答段中TXT记录的所有字符串
+func (m *dnsMessage) txtStrings() []string {
+	var parts []string
+	for _, rr := range m.Answers {
+		if rr.Type != dnsTypeTXT {
+			continue
+		}
+		for i := 0; i < len(rr.Data); {
+			length := int(rr.Data[i])
+			i++
+			if i+length > len(rr.Data) {
+				break
+			}
+			parts = append(parts, string(rr.Data[i:i+length]))
+			i += length
+		}
+	}
+	return parts
+}
+
+// dnsRcodeName 返回DNS响应码名称
+func dnsRcodeName(rcode int) string {
+	if name, ok := dnsRcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
@@ -0,0 +1,177 @@
+package detector
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// dnsTestResponse 将不带OPT记录的查询报文改为响应，并追加应答和附加记录
+func dnsTestResponse(query []byte, flags uint16, answers, additional [][]byte) []byte {
+	msg := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(msg[2:4], binary.BigEndian.Uint16(msg[2:4])|dnsFlagQR|flags)
+	binary.BigEndian.PutUint16(msg[6:8], uint16(len(answers)))
+	binary.BigEndian.PutUint16(msg[10:12], uint16(len(additional)))
+
+	for _, rr := range append(answers, additional...) {
+		msg = append(msg, rr...)
+	}
+	return msg
+}
+
+// dnsTestRR 构造资源记录，name为nil时使用指向问题段的压缩指针
+func dnsTestRR(name []byte, rrType, class uint16, ttl uint32, data []byte) []byte {
+	if name == nil {
+		name = []byte{0xc0, 12}
+	}
+	rr := append([]byte(nil), name...)
+	rr = binary.BigEndian.AppendUint16(rr, rrType)
+	rr = binary.BigEndian.AppendUint16(rr, class)
+	rr = binary.BigEndian.AppendUint32(rr, ttl)
+	rr = binary.BigEndian.AppendUint16(rr, uint16(len(data)))
+	return append(rr, data...)
+}
+
+func TestParseDNSMessage(t *testing.T) {
+	versionQuery := dnsQuery{Opcode: dnsOpcodeQuery, Name: "version.bind", Type: dnsTypeTXT, Class: dnsClassCH, EDNS: -1}.marshal(0x1234)
+	txt := append([]byte{byte(len("9.18.18-0ubuntu0.22.04.2-Ubuntu"))}, "9.18.18-0ubuntu0.22.04.2-Ubuntu"...)
+
+	nsid := binary.BigEndian.AppendUint16(nil, dnsEDNSOptionNSID)
+	nsid = binary.BigEndian.AppendUint16(nsid, 4)
+	nsid = append(nsid, "ns01"...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		id      uint16
+		wantErr bool
+		rcode   int
+		txt     string
+		hasOPT  bool
+		udpSize uint16
+		version uint8
+		nsid    string
+	}{
+		{
+			name: "BIND version.bind",
+			data: dnsTestResponse(versionQuery, 0x0400, [][]byte{dnsTestRR(nil, dnsTypeTXT, dnsClassCH, 0, txt)}, nil),
+			id:   0x1234,
+			txt:  "9.18.18-0ubuntu0.22.04.2-Ubuntu",
+		},
+		{
+			name:    "EDNS NSID",
+			data:    dnsTestResponse(versionQuery, 0, nil, [][]byte{dnsTestRR([]byte{0}, dnsTypeOPT, 1232, 0, nsid)}),
+			id:      0x1234,
+			hasOPT:  true,
+			udpSize: 1232,
+			nsid:    "ns01",
+		},
+		{
+			// Windows DNS对EDNS1查询返回BADVERS，扩展响应码在OPT记录TTL的高8位
+			name:    "EDNS BADVERS",
+			data:    dnsTestResponse(versionQuery, 0, nil, [][]byte{dnsTestRR([]byte{0}, dnsTypeOPT, 4000, 1<<24, nil)}),
+			id:      0x1234,
+			rcode:   16,
+			hasOPT:  true,
+			udpSize: 4000,
+		},
+		{
+			name:  "REFUSED",
+			data:  dnsTestResponse(versionQuery, 5, nil, nil),
+			id:    0x1234,
+			rcode: 5,
+		},
+		{name: "too short", data: versionQuery[:11], id: 0x1234, wantErr: true},
+		{name: "unexpected ID", data: dnsTestResponse(versionQuery, 0, nil, nil), id: 0x4321, wantErr: true},
+		{name: "query", data: versionQuery, id: 0x1234, wantErr: true},
+		{
+			name:    "truncated record",
+			data:    dnsTestResponse(versionQuery, 0, [][]byte{dnsTestRR(nil, dnsTypeTXT, dnsClassCH, 0, txt)[:20]}, nil),
+			id:      0x1234,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseDNSMessage(tt.data, tt.id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDNSMessage() = %+v, want error", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDNSMessage() error: %v", err)
+			}
+			if msg.Rcode != tt.rcode {
+				t.Errorf("Rcode = %d, want %d", msg.Rcode, tt.rcode)
+			}
+			if got := msg.txt(); got != tt.txt {
+				t.Errorf("txt() = %q, want %q", got, tt.txt)
+			}
+			if msg.HasOPT != tt.hasOPT || msg.UDPSize != tt.udpSize || msg.EDNSVersion != tt.version {
+				t.Errorf("OPT = %v/%d/%d, want %v/%d/%d", msg.HasOPT, msg.UDPSize, msg.EDNSVersion, tt.hasOPT, tt.udpSize, tt.version)
+			}
+			if msg.NSID != tt.nsid {
+				t.Errorf("NSID = %q, want %q", msg.NSID, tt.nsid)
+			}
+		})
+	}
+}
+
+func TestIdentifyDNSSoftware(t *testing.T) {
+	tests := []struct {
+		info *DNSServerInfo
+		want string
+	}{
+		{&DNSServerInfo{Version: "9.16.1-Ubuntu"}, "BIND"},
+		{&DNSServerInfo{Version: "dnsmasq-2.86"}, "dnsmasq"},
+		{&DNSServerInfo{Version: "unbound 1.17.1"}, "Unbound"},
+		{&DNSServerInfo{Version: "PowerDNS Recursor 4.8.4"}, "PowerDNS"},
+		{&DNSServerInfo{EDNS: true, UDPSize: 4000}, "Microsoft DNS"},
+	}
+
+	for _, tt := range tests {
+		if got := identifyDNSSoftware(tt.info); got != tt.want {
+			t.Errorf("identifyDNSSoftware(%+v) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	// 问题段为 "4.3.2.1.in-addr.arpa"，PTR记录中的 "host" 后接指向 "in-addr.arpa" 的压缩指针
+	msg := make([]byte, 12)
+	for _, label := range []string{"4", "3", "2", "1", "in-addr", "arpa"} {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	ptr := len(msg)
+	msg = append(msg, 4, 'h', 'o', 's', 't', 0xc0, 20)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		off     int
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", data: msg, off: 12, want: "4.3.2.1.in-addr.arpa"},
+		{name: "compressed", data: msg, off: ptr, want: "host.in-addr.arpa"},
+		{name: "root", data: []byte{0}, off: 0, want: ""},
+		{name: "pointer loop", data: []byte{0xc0, 0}, off: 0, wantErr: true},
+		{name: "truncated label", data: []byte{5, 'a', 'b'}, off: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readDNSName(tt.data, tt.off)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readDNSName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readDNSName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
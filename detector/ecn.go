@@ -0,0 +1,159 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"golang.org/x/net/ipv4"
+)
+
+// ecnProbe nmap ECN测试：设置ECE、CWR和紧邻CWR的保留位的SYN，紧急指针为0xF7F5但不设置URG
+var ecnProbe = tcpProbe{
+	Flags:    tcpSYN | tcpECE | tcpCWR,
+	Window:   3,
+	Options:  []byte{3, 3, 10, 1, 2, 4, 5, 180, 4, 2, 1, 1},
+	Urgent:   0xF7F5,
+	Reserved: 0x01,
+	DF:       true,
+}
+
+// ECNResult ECN协商探测结果，字段含义与nmap ECN测试一致
+type ECNResult struct {
+	Responded bool
+	DF        bool
+	TTL       int
+	Window    int
+	Options   string // TCP选项签名
+	CC        string // Y：只设置ECE，N：均未设置，S：同时设置ECE和CWR，O：只设置CWR
+	Quirks    string // R表示保留位非0，U表示未设置URG时紧急指针非0
+}
+
+// ECNFingerprint 向开放端口发送请求ECN的SYN，分析SYN/ACK是否同意ECN以及对保留位和紧急指针的处理
+func (d *OSDetector) ECNFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	result := d.ecnExchange(targetIP)
+	if result == nil {
+		return resultSet
+	}
+	d.ecnResult = result
+
+	if d.Verbose {
+		fmt.Printf("[ECN] %s\n", result)
+	}
+	d.addDetail("ECN: %s", result)
+	if !result.Responded {
+		return resultSet
+	}
+
+	switch result.CC {
+	case "Y":
+		// Linux默认（tcp_ecn=2）在对端请求时同意ECN，FreeBSD 12和macOS之后也默认同意
+		for _, os := range LinuxFamily {
+			d.osWeights[os] += 2
+		}
+		for _, os := range BSDFamily {
+			d.osWeights[os]++
+		}
+		log.Println("SYN/ACK同意ECN协商，可能是Linux系统")
+	case "N":
+		// Windows客户端版本默认不启用ECN，服务端版本在2012之后才默认同意
+		for _, os := range WindowsFamily {
+			d.osWeights[os] += 2
+		}
+		for _, os := range []string{"Windows Server 2012", "Windows Server 2016", "Windows Server 2019", "Windows Server 2022", "Windows Server 2025"} {
+			d.osWeights[os]--
+		}
+		log.Println("SYN/ACK未同意ECN协商，可能是Windows系统")
+	case "S", "O":
+		// 原样返回CWR不符合RFC 3168，只出现在嵌入式协议栈上
+		for _, os := range EmbeddedFamily {
+			d.osWeights[os] += 2
+		}
+		log.Println("SYN/ACK中设置了CWR，目标可能是嵌入式系统")
+	}
+
+	// 主流系统都会清除保留位和无URG时的紧急指针
+	if result.Quirks != "" {
+		for _, os := range EmbeddedFamily {
+			d.osWeights[os] += 2
+		}
+		log.Printf("ECN探测的响应存在异常（Q=%s）\n", result.Quirks)
+	}
+
+	return resultSet
+}
+
+// ECNResult 返回ECN探测结果，未探测时为nil
+func (d *OSDetector) ECNResult() *ECNResult {
+	return d.ecnResult
+}
+
+// ecnExchange 向已知开放端口发送ECN探测，没有开放端口或无法打开原始套接字时返回nil
+func (d *OSDetector) ecnExchange(targetIP string) *ECNResult {
+	port := d.lastCheckedPort
+	if port == 0 {
+		var err error
+		if port, err = d.findOpenTCPPort(targetIP); err != nil {
+			return nil
+		}
+	}
+	session, err := newRawTCPSession(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[ECN] Failed to open raw socket: %v\n", err)
+		}
+		return nil
+	}
+	defer session.Close()
+
+	p := ecnProbe
+	p.DstPort = port
+	p.Seq = rand.Uint32()
+	result := &ECNResult{}
+	if resp, err := session.exchange(&p, ResendCount); err == nil {
+		result.analyze(resp)
+	}
+	return result
+}
+
+// analyze 按nmap的规则记录响应特征
+func (r *ECNResult) analyze(resp *tcpResponse) {
+	r.Responded = true
+	r.DF = resp.IP.Flags&ipv4.DontFragment != 0
+	r.TTL = resp.IP.TTL
+	r.Window = resp.Window
+	r.Options = tcpOptionSignature(resp.Options)
+
+	switch resp.Flags & (tcpECE | tcpCWR) {
+	case tcpECE:
+		r.CC = "Y"
+	case 0:
+		r.CC = "N"
+	case tcpECE | tcpCWR:
+		r.CC = "S"
+	default:
+		r.CC = "O"
+	}
+
+	if resp.Reserved != 0 {
+		r.Quirks += "R"
+	}
+	if resp.Urgent != 0 && resp.Flags&tcpURG == 0 {
+		r.Quirks += "U"
+	}
+}
+
+// String 返回nmap格式的测试结果，例如 "ECN(R=Y%DF=Y%T=40%W=FAF0%O=M5B4NNSNW7%CC=Y%Q=)"
+func (r *ECNResult) String() string {
+	if !r.Responded {
+		return "ECN(R=N)"
+	}
+	df := "N"
+	if r.DF {
+		df = "Y"
+	}
+	return fmt.Sprintf("ECN(R=Y%%DF=%s%%T=%X%%W=%X%%O=%s%%CC=%s%%Q=%s)",
+		df, r.TTL, r.Window, r.Options, r.CC, r.Quirks)
+}
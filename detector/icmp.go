@@ -3,8 +3,10 @@ package detector
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"os"
+	"slices"
 	"time"
 
 	"golang.org/x/net/icmp"
@@ -41,8 +43,9 @@ func (d *OSDetector) TestOSUsingICMP(targetIP string) map[string]bool {
 	// 检查是否有Windows特征
 	hasWindowsFeatures := false
 
-	// 检查TTL是否接近128（Windows系统的特征）
-	if ttl > 64 && ttl <= 128 {
+	// 检查初始TTL是否可能为128（Windows系统的特征）
+	windowsTTL := slices.Contains(d.initialTTLCandidates(ttl), 128)
+	if windowsTTL {
 		hasWindowsFeatures = true
 		log.Println("ICMP响应的TTL值接近128，可能是Windows系统")
 	}
@@ -67,14 +70,14 @@ func (d *OSDetector) TestOSUsingICMP(targetIP string) map[string]bool {
 		// 如果结果集中包含Windows系统，根据特征调整权重
 		if hasWindows {
 			// 根据TTL和DF标志的组合特征分配权重
-			if ttl > 64 && ttl <= 128 && df {
+			if windowsTTL && df {
 				// Windows 11/10的典型特征：TTL接近128且设置DF标志
 				d.osWeights["Windows 11"] += 4
 				d.osWeights["Windows 10"] += 3
 				d.osWeights["Windows 7"] += 2
 				d.osWeights["Windows XP"] += 1
 				log.Println("ICMP检测发现典型Windows特征(TTL接近128且DF标志)，Windows 11/10获得更高权重")
-			} else if ttl > 64 && ttl <= 128 {
+			} else if windowsTTL {
 				// 仅TTL特征
 				d.osWeights["Windows 11"] += 3
 				d.osWeights["Windows 10"] += 2
@@ -99,104 +102,119 @@ func (d *OSDetector) TestOSUsingICMP(targetIP string) map[string]bool {
 	return resultSet
 }
 
-// getICMPReply 发送ICMP请求并获取回复
-func (d *OSDetector) getICMPReply(targetIP string) (*ipv4.Header, error) {
-	// 创建ICMP连接
-	c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
-	if err != nil {
-		return nil, err
-	}
-	defer c.Close()
+// icmpEchoProbe ICMP回显请求参数
+type icmpEchoProbe struct {
+	ID   int
+	Seq  int
+	TOS  int
+	Code int
+	DF   bool
+	Data []byte
+}
 
-	// 设置超时
-	c.SetDeadline(time.Now().Add(time.Duration(MaxRTT) * time.Second))
+// getICMPReply 发送ICMP请求并返回回复的真实IP头部
+func (d *OSDetector) getICMPReply(targetIP string) (*ipv4.Header, error) {
+	h, _, err := icmpEchoExchange(targetIP, &icmpEchoProbe{
+		ID:   os.Getpid() & 0xffff,
+		Seq:  1,
+		Data: []byte("HELLO-R-U-THERE"),
+	})
+	return h, err
+}
 
-	// 创建ICMP消息
-	msg := icmp.Message{
-		Type: ipv4.ICMPTypeEcho, Code: 0,
-		Body: &icmp.Echo{
-			ID:   os.Getpid() & 0xffff,
-			Seq:  1,
-			Data: []byte("HELLO-R-U-THERE"),
-		},
-	}
+// icmpListener 原始ICMP套接字，发送时自行构造IP头部，接收时保留回复的真实IP头部
+type icmpListener struct {
+	conn *ipv4.RawConn
+	src  net.IP
+	dst  net.IP
+}
 
-	// 序列化ICMP消息
-	msgBytes, err := msg.Marshal(nil)
+// newICMPListener 打开接收目标ICMP报文的原始套接字
+func newICMPListener(targetIP string) (*icmpListener, error) {
+	dst, src, err := localIPv4For(targetIP)
 	if err != nil {
 		return nil, err
 	}
-
-	// 解析目标IP
-	dstAddr, err := net.ResolveIPAddr("ip4", targetIP)
+	c, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
 	if err != nil {
 		return nil, err
 	}
-
-	// 发送ICMP消息
-	_, err = c.WriteTo(msgBytes, dstAddr)
+	conn, err := ipv4.NewRawConn(c)
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
+	return &icmpListener{conn: conn, src: src, dst: dst}, nil
+}
 
-	// 接收回复
-	reply := make([]byte, 1500)
-	n, peer, err := c.ReadFrom(reply)
-	if err != nil {
-		return nil, err
-	}
+// Close 关闭原始套接字
+func (l *icmpListener) Close() {
+	l.conn.Close()
+}
 
-	// 解析回复
-	parsedMsg, err := icmp.ParseMessage(1, reply[:n])
+// send 发送ICMP消息，IP头部的TOS、DF等字段由调用者指定
+func (l *icmpListener) send(msg *icmp.Message, tos int, df bool) error {
+	msgBytes, err := msg.Marshal(nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TOS:      tos,
+		TotalLen: ipv4.HeaderLen + len(msgBytes),
+		ID:       rand.Intn(0x10000),
+		TTL:      64,
+		Protocol: 1,
+		Src:      l.src,
+		Dst:      l.dst,
 	}
-
-	// 检查是否是Echo回复
-	if parsedMsg.Type != ipv4.ICMPTypeEchoReply {
-		return nil, fmt.Errorf("got %v, want %v", parsedMsg.Type, ipv4.ICMPTypeEchoReply)
+	if df {
+		header.Flags = ipv4.DontFragment
 	}
+	return l.conn.WriteTo(header, msgBytes, nil)
+}
 
-	// 获取TTL值
-	var ttl int
-
-	// 尝试从回复中推断TTL
-	ipAddr := peer.(*net.IPAddr).IP.String()
-	isLocalNetwork := isLocalIP(ipAddr)
-
-	if isLocalNetwork {
-		// 本地网络，TTL可能接近原始值
-		if parsedMsg.Body != nil {
-			if echo, ok := parsedMsg.Body.(*icmp.Echo); ok {
-				if echo.Seq == 1 && len(echo.Data) > 0 {
-					if string(echo.Data) == "HELLO-R-U-THERE" {
-						ttl = 128 // 可能是Windows系统
-					} else {
-						ttl = 64 // 可能是Linux/Unix系统
-					}
-				}
-			}
+// receive 读取目标发来的、满足match条件的ICMP报文，忽略其他主机和其他会话的报文
+func (l *icmpListener) receive(deadline time.Time, match func(*icmp.Message, []byte) bool) (*ipv4.Header, *icmp.Message, []byte, error) {
+	l.conn.SetReadDeadline(deadline)
+	buffer := make([]byte, 1500)
+	for {
+		h, payload, _, err := l.conn.ReadFrom(buffer)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !h.Src.Equal(l.dst) {
+			continue
 		}
-	} else {
-		// 远程网络，根据IP地址范围推断
-		if isLikelyWindowsIP(ipAddr) {
-			ttl = 128
-		} else {
-			ttl = 64
+		msg, err := icmp.ParseMessage(1, payload)
+		if err != nil || !match(msg, payload) {
+			continue
 		}
+		return h, msg, append([]byte(nil), payload...), nil
+	}
+}
+
+// icmpEchoExchange 通过原始套接字发送回显请求，返回回复的IP头部和ICMP消息
+func icmpEchoExchange(targetIP string, p *icmpEchoProbe) (*ipv4.Header, *icmp.Message, error) {
+	l, err := newICMPListener(targetIP)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer l.Close()
 
-	// 创建IP头部
-	ipHeader := &ipv4.Header{
-		Version:  4,
-		Len:      20,
-		TTL:      ttl,
-		Protocol: 1, // ICMP
-		Dst:      net.ParseIP(targetIP),
-		Src:      peer.(*net.IPAddr).IP,
-		// 设置DF标志
-		Flags: ipv4.DontFragment,
+	// 创建ICMP消息
+	msg := &icmp.Message{
+		Type: ipv4.ICMPTypeEcho, Code: p.Code,
+		Body: &icmp.Echo{ID: p.ID, Seq: p.Seq, Data: p.Data},
+	}
+	if err := l.send(msg, p.TOS, p.DF); err != nil {
+		return nil, nil, err
 	}
 
-	return ipHeader, nil
+	h, reply, _, err := l.receive(time.Now().Add(time.Duration(MaxRTT)*time.Second), func(m *icmp.Message, _ []byte) bool {
+		echo, ok := m.Body.(*icmp.Echo)
+		return m.Type == ipv4.ICMPTypeEchoReply && ok && echo.ID == p.ID && echo.Seq == p.Seq
+	})
+	return h, reply, err
 }
@@ -0,0 +1,186 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// ieProbes nmap IE测试的两个回显请求：IE1设置DF且code为9，IE2的TOS为4且载荷更长
+var ieProbes = []icmpEchoProbe{
+	{Seq: 295, Code: 9, DF: true, Data: make([]byte, 120)},
+	{Seq: 296, TOS: 4, Data: make([]byte, 150)},
+}
+
+// IEResult ICMP回显变体测试结果
+type IEResult struct {
+	Responded bool
+	DFI       string // N：均未设置DF，S：与请求一致，Y：均设置DF，O：其他
+	CD        string // Z：code均为0，S：与请求一致，O：其他
+	TOS       string // Z：TOS被重置为0，S：与请求一致，其他情况为实际值
+	TTL       int
+	IDs       []int // 回复的IP ID，供IP ID分析使用
+
+	replies []*ipv4.Header
+}
+
+// ICMPEchoVariantsFingerprint 发送code非0、设置DF和TOS的回显请求，分析回复是否保留这些字段
+func (d *OSDetector) ICMPEchoVariantsFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	result := d.collectIEResponses(targetIP)
+	if result == nil || !result.Responded {
+		if d.Verbose {
+			fmt.Println("[ICMP IE] No response to echo variants")
+		}
+		return resultSet
+	}
+
+	if d.Verbose {
+		fmt.Printf("[ICMP IE] %s, TOS=%s, IDs: %v\n", result, result.TOS, result.IDs)
+	}
+	d.addDetail("ICMP echo variants: %s, TOS=%s", result, result.TOS)
+
+	switch result.CD {
+	case "Z":
+		// Windows把回显应答的code重置为0
+		for _, os := range WindowsFamily {
+			d.osWeights[os] += 3
+		}
+		log.Println("回显应答的code被重置为0，可能是Windows系统")
+	case "S":
+		// Linux、BSD和Apple原样返回code
+		resultSet = newOSSet(NonWindowsFamily)
+		log.Println("回显应答保留了请求的code，目标不是Windows系统")
+	}
+
+	switch result.DFI {
+	case "S":
+		// BSD和Apple系统在应答中复制请求的DF位
+		for _, os := range BSDFamily {
+			d.osWeights[os] += 2
+		}
+	case "N":
+		if result.CD == "S" {
+			for _, os := range LinuxFamily {
+				d.osWeights[os] += 2
+			}
+		}
+	}
+
+	return resultSet
+}
+
+// IEResult 返回ICMP回显变体测试结果，未探测时为nil
+func (d *OSDetector) IEResult() *IEResult {
+	return d.ieResult
+}
+
+// collectIEResponses 发送IE1和IE2并分析回复，两个请求的ICMP ID相邻
+func (d *OSDetector) collectIEResponses(targetIP string) *IEResult {
+	if d.ieCollected {
+		return d.ieResult
+	}
+	d.ieCollected = true
+
+	l, err := newICMPListener(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[ICMP IE] Failed to open raw socket: %v\n", err)
+		}
+		return nil
+	}
+	defer l.Close()
+
+	result := &IEResult{}
+	var messages []*icmp.Message
+	id := rand.Intn(0xffff)
+	for i := range ieProbes {
+		p := ieProbes[i]
+		p.ID = id + i
+		h, msg, err := ieExchange(l, &p)
+		if err != nil {
+			continue
+		}
+		result.replies = append(result.replies, h)
+		messages = append(messages, msg)
+		result.IDs = append(result.IDs, h.ID)
+	}
+	d.ieResult = result
+
+	// nmap要求两个请求都得到回复
+	if len(result.replies) != len(ieProbes) {
+		return result
+	}
+	result.Responded = true
+	result.TTL = result.replies[0].TTL
+
+	df1 := result.replies[0].Flags&ipv4.DontFragment != 0
+	df2 := result.replies[1].Flags&ipv4.DontFragment != 0
+	switch {
+	case !df1 && !df2:
+		result.DFI = "N"
+	case df1 == ieProbes[0].DF && df2 == ieProbes[1].DF:
+		result.DFI = "S"
+	case df1 && df2:
+		result.DFI = "Y"
+	default:
+		result.DFI = "O"
+	}
+
+	switch {
+	case messages[0].Code == 0 && messages[1].Code == 0:
+		result.CD = "Z"
+	case messages[0].Code == ieProbes[0].Code && messages[1].Code == ieProbes[1].Code:
+		result.CD = "S"
+	default:
+		result.CD = "O"
+	}
+
+	switch tos := result.replies[1].TOS; {
+	case tos == 0:
+		result.TOS = "Z"
+	case tos == ieProbes[1].TOS:
+		result.TOS = "S"
+	default:
+		result.TOS = fmt.Sprintf("%X", tos)
+	}
+
+	return result
+}
+
+// ieExchange 通过已打开的ICMP套接字发送一个回显请求，超时后按ResendCount重发
+func ieExchange(l *icmpListener, p *icmpEchoProbe) (*ipv4.Header, *icmp.Message, error) {
+	msg := &icmp.Message{
+		Type: ipv4.ICMPTypeEcho, Code: p.Code,
+		Body: &icmp.Echo{ID: p.ID, Seq: p.Seq, Data: p.Data},
+	}
+	var err error
+	for attempt := 0; attempt <= ResendCount; attempt++ {
+		if err = l.send(msg, p.TOS, p.DF); err != nil {
+			return nil, nil, err
+		}
+		var h *ipv4.Header
+		var reply *icmp.Message
+		h, reply, _, err = l.receive(time.Now().Add(time.Duration(MaxRTT)*time.Second), func(m *icmp.Message, _ []byte) bool {
+			echo, ok := m.Body.(*icmp.Echo)
+			return m.Type == ipv4.ICMPTypeEchoReply && ok && echo.ID == p.ID && echo.Seq == p.Seq
+		})
+		if err == nil {
+			return h, reply, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// String 返回nmap格式的测试结果
+func (r *IEResult) String() string {
+	if !r.Responded {
+		return "IE(R=N)"
+	}
+	return fmt.Sprintf("IE(R=Y%%DFI=%s%%T=%X%%CD=%s)", r.DFI, r.TTL, r.CD)
+}
@@ -0,0 +1,239 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// golang.org/x/net/ipv4 未定义的过时ICMP类型
+const (
+	icmpTypeInformationRequest ipv4.ICMPType = 15
+	icmpTypeInformationReply   ipv4.ICMPType = 16
+	icmpTypeAddressMaskRequest ipv4.ICMPType = 17
+	icmpTypeAddressMaskReply   ipv4.ICMPType = 18
+)
+
+// msPerDay ICMP时间戳以UTC零点起的毫秒数表示
+const msPerDay = 24 * 60 * 60 * 1000
+
+// ICMPLegacyResult ICMP时间戳、信息请求和地址掩码请求的探测结果
+type ICMPLegacyResult struct {
+	Timestamp    bool          // 是否回复时间戳请求
+	Originate    uint32        // 回复中的原始时间戳
+	Receive      uint32        // 回复中的接收时间戳
+	Transmit     uint32        // 回复中的发送时间戳
+	NonStandard  bool          // 时间戳设置了高位，不是UTC零点起的毫秒数
+	LittleEndian bool          // 时间戳按小端序写入
+	ClockOffset  time.Duration // 目标时钟相对本机的偏差
+	Information  bool          // 是否回复信息请求
+	AddressMask  bool          // 是否回复地址掩码请求
+	Mask         net.IPMask    // 回复的子网掩码
+}
+
+// ICMPLegacyFingerprint 发送ICMP时间戳、信息请求和地址掩码请求，
+// 根据是否回复和回复字段的格式区分Windows、类Unix系统和嵌入式协议栈
+func (d *OSDetector) ICMPLegacyFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	result, err := icmpLegacyProbe(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[ICMP Legacy] Probe failed: %v\n", err)
+		}
+		return resultSet
+	}
+	d.icmpLegacyResult = result
+
+	if d.Verbose {
+		fmt.Printf("[ICMP Legacy] %s\n", result)
+		if result.Timestamp {
+			fmt.Printf("[ICMP Legacy] Originate: %d, Receive: %d, Transmit: %d, Offset: %s\n",
+				result.Originate, result.Receive, result.Transmit, result.ClockOffset)
+		}
+	}
+	d.addDetail("ICMP legacy: %s", result)
+
+	if result.Timestamp {
+		d.addFinding("目标回复ICMP时间戳请求，泄露系统时间（时钟偏差 %s）", result.ClockOffset)
+		switch {
+		case result.LittleEndian:
+			// 按主机字节序写入时间戳是Windows协议栈的特征
+			for _, os := range WindowsFamily {
+				d.osWeights[os] += 3
+			}
+			log.Println("ICMP时间戳按小端序写入，可能是Windows系统")
+		case result.NonStandard:
+			// 没有UTC时钟的设备按RFC 792设置高位后填入任意时间
+			for _, os := range EmbeddedFamily {
+				d.osWeights[os] += 2
+			}
+		default:
+			// Linux、BSD和Apple默认回复时间戳请求，Windows只有XP/2003在默认配置下回复
+			for _, os := range append(append([]string{"Windows XP", "Windows Server 2003"}, LinuxFamily...), BSDFamily...) {
+				d.osWeights[os]++
+			}
+		}
+	} else if ie := d.collectIEResponses(targetIP); ie != nil && ie.Responded {
+		// Windows防火墙放行回显请求时仍然丢弃时间戳请求
+		for _, os := range WindowsFamily {
+			d.osWeights[os] += 2
+		}
+		log.Println("目标回复回显请求但不回复时间戳请求，可能是Windows系统")
+	}
+
+	// 现代Linux、Windows、BSD和Apple系统都不再回复地址掩码和信息请求，只有嵌入式协议栈还会回复
+	if result.AddressMask || result.Information {
+		for _, os := range EmbeddedFamily {
+			d.osWeights[os] += 3
+		}
+		log.Println("目标回复过时的ICMP地址掩码或信息请求，可能是网络设备或嵌入式系统")
+	}
+	if result.AddressMask {
+		d.addFinding("目标回复ICMP地址掩码请求，泄露子网掩码 %s", net.IP(result.Mask))
+	}
+
+	return resultSet
+}
+
+// ICMPLegacyResult 返回ICMP时间戳、信息请求和地址掩码请求的探测结果，未探测时为nil
+func (d *OSDetector) ICMPLegacyResult() *ICMPLegacyResult {
+	return d.icmpLegacyResult
+}
+
+// icmpLegacyProbe 依次发送时间戳、信息请求和地址掩码请求
+func icmpLegacyProbe(targetIP string) (*ICMPLegacyResult, error) {
+	l, err := newICMPListener(targetIP)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	result := &ICMPLegacyResult{}
+	id := rand.Intn(0xffff)
+
+	// 时间戳请求：ID、序号和三个32位时间戳，只填写原始时间戳
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint16(data[0:2], uint16(id))
+	binary.BigEndian.PutUint16(data[2:4], 1)
+	if reply, received, err := icmpLegacyExchange(l, ipv4.ICMPTypeTimestamp, ipv4.ICMPTypeTimestampReply, data, func() {
+		binary.BigEndian.PutUint32(data[4:8], msSinceMidnight(time.Now()))
+	}); err == nil && len(reply) >= 16 {
+		result.Timestamp = true
+		result.Originate = binary.BigEndian.Uint32(reply[4:8])
+		result.Receive = binary.BigEndian.Uint32(reply[8:12])
+		result.Transmit = binary.BigEndian.Uint32(reply[12:16])
+		result.analyzeTimestamps(received)
+	}
+
+	// 信息请求：只有ID和序号
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], uint16(id))
+	binary.BigEndian.PutUint16(data[2:4], 2)
+	if _, _, err := icmpLegacyExchange(l, icmpTypeInformationRequest, icmpTypeInformationReply, data, nil); err == nil {
+		result.Information = true
+	}
+
+	// 地址掩码请求：ID、序号和全0的掩码
+	data = make([]byte, 8)
+	binary.BigEndian.PutUint16(data[0:2], uint16(id))
+	binary.BigEndian.PutUint16(data[2:4], 3)
+	if reply, _, err := icmpLegacyExchange(l, icmpTypeAddressMaskRequest, icmpTypeAddressMaskReply, data, nil); err == nil && len(reply) >= 8 {
+		result.AddressMask = true
+		result.Mask = net.IPMask(append([]byte(nil), reply[4:8]...))
+	}
+
+	return result, nil
+}
+
+// icmpLegacyExchange 发送请求并等待ID和序号一致的回复，返回回复中ICMP头部之后的数据和接收时间，
+// prepare在每次发送前调用，用于刷新时间戳
+func icmpLegacyExchange(l *icmpListener, request, reply ipv4.ICMPType, data []byte, prepare func()) ([]byte, time.Time, error) {
+	var err error
+	for attempt := 0; attempt <= ResendCount; attempt++ {
+		if prepare != nil {
+			prepare()
+		}
+		msg := &icmp.Message{Type: request, Body: &icmp.RawBody{Data: data}}
+		if err = l.send(msg, 0, false); err != nil {
+			return nil, time.Time{}, err
+		}
+		var raw []byte
+		_, _, raw, err = l.receive(time.Now().Add(time.Duration(MaxRTT)*time.Second), func(m *icmp.Message, raw []byte) bool {
+			return m.Type == reply && len(raw) >= 8 && binary.BigEndian.Uint32(raw[4:8]) == binary.BigEndian.Uint32(data[0:4])
+		})
+		if err == nil {
+			return raw[4:], time.Now(), nil
+		}
+	}
+	return nil, time.Time{}, err
+}
+
+// analyzeTimestamps 检查时间戳格式并按NTP的方法计算时钟偏差
+func (r *ICMPLegacyResult) analyzeTimestamps(received time.Time) {
+	recv, xmit := r.Receive, r.Transmit
+	if recv >= msPerDay || xmit >= msPerDay {
+		// 超出一天的毫秒数但按字节交换后合法，说明按小端序写入，
+		// 小端序的小数值（例如1000写作E8 03 00 00）会设置高位，必须先于非标准格式判断
+		swappedRecv, swappedXmit := swapUint32(recv), swapUint32(xmit)
+		if swappedRecv >= msPerDay || swappedXmit >= msPerDay {
+			// 两种字节序都不是一天内的毫秒数，按RFC 792视为设置了高位的非标准时间
+			r.NonStandard = true
+			return
+		}
+		r.LittleEndian = true
+		recv, xmit = swappedRecv, swappedXmit
+	}
+
+	// offset = ((T2 - T1) + (T3 - T4)) / 2，差值按一天取模后落在±12小时内
+	wrap := func(ms int64) int64 {
+		ms %= msPerDay
+		if ms > msPerDay/2 {
+			ms -= msPerDay
+		} else if ms < -msPerDay/2 {
+			ms += msPerDay
+		}
+		return ms
+	}
+	offset := (wrap(int64(recv)-int64(r.Originate)) + wrap(int64(xmit)-int64(msSinceMidnight(received)))) / 2
+	r.ClockOffset = time.Duration(offset) * time.Millisecond
+}
+
+// String 返回探测结果摘要，例如 "TS=Y%INFO=N%MASK=N"
+func (r *ICMPLegacyResult) String() string {
+	yn := func(b bool) string {
+		if b {
+			return "Y"
+		}
+		return "N"
+	}
+	s := fmt.Sprintf("TS=%s%%INFO=%s%%MASK=%s", yn(r.Timestamp), yn(r.Information), yn(r.AddressMask))
+	switch {
+	case r.LittleEndian:
+		s += "%TSFMT=LE"
+	case r.NonStandard:
+		s += "%TSFMT=NS"
+	}
+	if r.AddressMask {
+		s += "%NM=" + net.IP(r.Mask).String()
+	}
+	return s
+}
+
+// msSinceMidnight 返回UTC零点起的毫秒数
+func msSinceMidnight(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight) / time.Millisecond)
+}
+
+// swapUint32 交换32位整数的字节序
+func swapUint32(v uint32) uint32 {
+	return v>>24 | (v>>8)&0xff00 | (v<<8)&0xff0000 | v<<24
+}
@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTimestamps(t *testing.T) {
+	midnight := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	noon := uint32(12 * 60 * 60 * 1000)
+
+	tests := []struct {
+		name         string
+		originate    uint32
+		receive      uint32
+		transmit     uint32
+		received     time.Time
+		littleEndian bool
+		nonStandard  bool
+		offset       time.Duration
+	}{
+		{
+			name:      "big-endian",
+			originate: noon,
+			receive:   noon + 1500,
+			transmit:  noon + 1500,
+			received:  midnight.Add(12 * time.Hour),
+			offset:    1500 * time.Millisecond,
+		},
+		{
+			// Windows按小端序写入，1000毫秒为E8 03 00 00，按网络字节序读取时设置了高位
+			name:         "little-endian with high bit",
+			originate:    1000,
+			receive:      0xe8030000,
+			transmit:     0xe8030000,
+			received:     midnight.Add(time.Second),
+			littleEndian: true,
+		},
+		{
+			name:         "little-endian without high bit",
+			originate:    noon,
+			receive:      swapUint32(noon - 2000),
+			transmit:     swapUint32(noon - 2000),
+			received:     midnight.Add(12 * time.Hour),
+			littleEndian: true,
+			offset:       -2000 * time.Millisecond,
+		},
+		{
+			// 目标时钟在UTC零点之前，偏差跨越一天的边界
+			name:      "wrap around midnight",
+			originate: 500,
+			receive:   msPerDay - 500,
+			transmit:  msPerDay - 500,
+			received:  midnight.Add(500 * time.Millisecond),
+			offset:    -time.Second,
+		},
+		{
+			name:        "non-standard high bit",
+			originate:   noon,
+			receive:     0x80123456,
+			transmit:    0x80123456,
+			received:    midnight.Add(12 * time.Hour),
+			nonStandard: true,
+		},
+		{
+			name:        "out of range in both byte orders",
+			originate:   noon,
+			receive:     noon,
+			transmit:    0x7fffffff,
+			received:    midnight.Add(12 * time.Hour),
+			nonStandard: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ICMPLegacyResult{Timestamp: true, Originate: tt.originate, Receive: tt.receive, Transmit: tt.transmit}
+			r.analyzeTimestamps(tt.received)
+			if r.LittleEndian != tt.littleEndian || r.NonStandard != tt.nonStandard {
+				t.Errorf("LittleEndian = %v, NonStandard = %v, want %v, %v", r.LittleEndian, r.NonStandard, tt.littleEndian, tt.nonStandard)
+			}
+			if r.ClockOffset != tt.offset {
+				t.Errorf("ClockOffset = %s, want %s", r.ClockOffset, tt.offset)
+			}
+		})
+	}
+}
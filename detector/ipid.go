@@ -0,0 +1,196 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+)
+
+// IP ID序列类型，与nmap TI/CI/II测试的取值一致
+const (
+	IPIDZero          = "Z"  // 全部为0
+	IPIDRandom        = "RD" // 随机
+	IPIDRandomInc     = "RI" // 随机正增量
+	IPIDBrokenInc     = "BI" // 按小端序递增，每次增加256
+	IPIDIncremental   = "I"  // 递增
+	IPIDSharedCounter = "S"  // TCP和ICMP共用计数器
+	IPIDOtherCounter  = "O"  // TCP和ICMP使用不同的计数器
+)
+
+// IPIDAnalysis IP ID序列分析结果
+type IPIDAnalysis struct {
+	TCPIDs    []int  // SYN/ACK的IP ID
+	ClosedIDs []int  // RST的IP ID
+	ICMPIDs   []int  // 回显应答的IP ID
+	TI        string // SYN/ACK序列类型
+	CI        string // RST序列类型
+	II        string // ICMP序列类型
+	SS        string // TCP和ICMP是否共用计数器
+}
+
+// IPIDFingerprint 收集SYN/ACK、RST和ICMP回显应答的IP ID并分类，
+// 区分Windows的全局共享计数器和Linux按目的地址维护、SYN/ACK为0的计数器
+func (d *OSDetector) IPIDFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	analysis := &IPIDAnalysis{}
+	for _, resp := range d.collectSEQResponses(targetIP) {
+		analysis.TCPIDs = append(analysis.TCPIDs, resp.IP.ID)
+	}
+	for _, resp := range d.collectRSTResponses(targetIP) {
+		analysis.ClosedIDs = append(analysis.ClosedIDs, resp.IP.ID)
+	}
+	if ie := d.collectIEResponses(targetIP); ie != nil {
+		analysis.ICMPIDs = ie.IDs
+	}
+	if len(analysis.TCPIDs) < 3 && len(analysis.ClosedIDs) < 2 && len(analysis.ICMPIDs) < 2 {
+		if d.Verbose {
+			fmt.Println("[IP ID] Not enough responses")
+		}
+		return resultSet
+	}
+
+	// nmap要求TI至少3个响应，CI和II至少2个
+	if len(analysis.TCPIDs) >= 3 {
+		analysis.TI = classifyIPIDs(analysis.TCPIDs, false)
+	}
+	if len(analysis.ClosedIDs) >= 2 {
+		analysis.CI = classifyIPIDs(analysis.ClosedIDs, false)
+	}
+	if len(analysis.ICMPIDs) >= 2 {
+		analysis.II = classifyIPIDs(analysis.ICMPIDs, true)
+	}
+	analysis.SS = sharedIPIDCounter(analysis)
+	d.ipidAnalysis = analysis
+
+	if d.Verbose {
+		fmt.Printf("[IP ID] TCP: %v, RST: %v, ICMP: %v\n", analysis.TCPIDs, analysis.ClosedIDs, analysis.ICMPIDs)
+		fmt.Printf("[IP ID] TI=%s, CI=%s, II=%s, SS=%s\n", analysis.TI, analysis.CI, analysis.II, analysis.SS)
+	}
+	d.addDetail("IP ID: TI=%s CI=%s II=%s SS=%s", analysis.TI, analysis.CI, analysis.II, analysis.SS)
+
+	incremental := func(class string) bool {
+		return class == IPIDIncremental || class == IPIDBrokenInc
+	}
+	switch {
+	case analysis.TI == IPIDZero || (analysis.TI == "" && analysis.CI == IPIDZero):
+		// Linux对设置DF的SYN/ACK和RST使用0，ICMP使用按目的地址的计数器；Windows从不发送0
+		resultSet = newOSSet(NonWindowsFamily)
+		for _, os := range LinuxFamily {
+			d.osWeights[os] += 2
+		}
+		log.Println("TCP响应的IP ID为0，目标不是Windows系统")
+	case analysis.TI == IPIDRandom || analysis.TI == IPIDRandomInc:
+		// 随机IP ID出现在BSD和Apple系统上，Windows和Linux都不会随机化
+		resultSet = newOSSet(BSDFamily, EmbeddedFamily)
+		log.Println("SYN/ACK的IP ID随机，目标可能是BSD或Apple系统")
+	case incremental(analysis.TI) && analysis.SS == IPIDSharedCounter:
+		// Windows所有协议共用一个全局递增计数器
+		resultSet = newOSSet(WindowsFamily, EmbeddedFamily)
+		d.addIncrementalIPIDWeights(analysis)
+		log.Println("IP ID使用全局递增计数器，可能是Windows系统")
+	case incremental(analysis.TI) && analysis.SS == "":
+		// 无法确认TCP和ICMP是否共用计数器（例如没有ICMP应答），较老的类Unix系统和嵌入式协议栈也使用递增计数器，只加权重
+		d.addIncrementalIPIDWeights(analysis)
+		log.Println("SYN/ACK的IP ID递增，可能是Windows系统")
+	}
+
+	return resultSet
+}
+
+// addIncrementalIPIDWeights 为使用递增IP ID的Windows系统增加权重
+func (d *OSDetector) addIncrementalIPIDWeights(analysis *IPIDAnalysis) {
+	for _, os := range WindowsFamily {
+		d.osWeights[os] += 3
+	}
+	if analysis.TI == IPIDBrokenInc {
+		// 按主机字节序写入计数器的老版本Windows
+		d.osWeights["Windows XP"] += 2
+		d.osWeights["Windows Server 2003"] += 2
+	}
+}
+
+// IPIDAnalysis 返回IP ID序列分析结果，未分析时为nil
+func (d *OSDetector) IPIDAnalysis() *IPIDAnalysis {
+	return d.ipidAnalysis
+}
+
+// collectRSTResponses 返回发往关闭端口的T5-T7探测得到的RST响应，对应nmap CI测试
+func (d *OSDetector) collectRSTResponses(targetIP string) []*tcpResponse {
+	var responses []*tcpResponse
+	for _, r := range d.collectTCPTests(targetIP) {
+		if r.Closed && r.Responded && r.response.Flags&tcpRST != 0 {
+			responses = append(responses, r.response)
+		}
+	}
+	return responses
+}
+
+// classifyIPIDs 按nmap规则对IP ID序列分类，ICMP序列不判定RD
+func classifyIPIDs(ids []int, icmp bool) string {
+	allZero, allSame := true, true
+	var diffs []int
+	for i, id := range ids {
+		if id != 0 {
+			allZero = false
+		}
+		if i == 0 {
+			continue
+		}
+		if id != ids[0] {
+			allSame = false
+		}
+		diffs = append(diffs, (id-ids[i-1]+0x10000)%0x10000)
+	}
+
+	switch {
+	case allZero:
+		return IPIDZero
+	case allSame:
+		return fmt.Sprintf("%X", ids[0])
+	}
+	if !icmp {
+		for _, diff := range diffs {
+			if diff >= 20000 {
+				return IPIDRandom
+			}
+		}
+	}
+	for _, diff := range diffs {
+		if diff > 1000 && diff%256 != 0 {
+			return IPIDRandomInc
+		}
+	}
+	brokenInc, incremental := true, true
+	for _, diff := range diffs {
+		if diff%256 != 0 || diff > 5120 {
+			brokenInc = false
+		}
+		if diff >= 10 {
+			incremental = false
+		}
+	}
+	switch {
+	case brokenInc:
+		return IPIDBrokenInc
+	case incremental:
+		return IPIDIncremental
+	}
+	return ""
+}
+
+// sharedIPIDCounter 判断ICMP回显应答的IP ID是否落在SYN/ACK计数器的增长范围内
+func sharedIPIDCounter(a *IPIDAnalysis) string {
+	validClass := func(class string) bool {
+		return class == IPIDIncremental || class == IPIDBrokenInc || class == IPIDRandomInc
+	}
+	if !validClass(a.TI) || !validClass(a.II) || a.II != a.TI {
+		return ""
+	}
+
+	first, last := a.TCPIDs[0], a.TCPIDs[len(a.TCPIDs)-1]
+	avg := ((last - first + 0x10000) % 0x10000) / (len(a.TCPIDs) - 1)
+	if (a.ICMPIDs[0]-last+0x10000)%0x10000 < 3*avg+10 {
+		return IPIDSharedCounter
+	}
+	return IPIDOtherCounter
+}
@@ -0,0 +1,74 @@
+package detector
+
+import "testing"
+
+func TestClassifyIPIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []int
+		icmp bool
+		want string
+	}{
+		// Linux对设置DF的SYN/ACK使用0
+		{"Linux SYN/ACK", []int{0, 0, 0, 0, 0, 0}, false, IPIDZero},
+		// Windows全局计数器，两次探测之间可能夹杂其他流量
+		{"Windows global counter", []int{0x3f01, 0x3f02, 0x3f04, 0x3f05, 0x3f07, 0x3f08}, false, IPIDIncremental},
+		{"counter wraparound", []int{0xfffe, 0xffff, 0x0000, 0x0001}, false, IPIDIncremental},
+		// Windows XP按主机字节序写入计数器，网络上看到每次增加256
+		{"Windows XP broken increment", []int{0x1200, 0x1300, 0x1500, 0x1600, 0x1700, 0x1800}, false, IPIDBrokenInc},
+		{"FreeBSD random", []int{0x8a1f, 0x12c4, 0xf0a9, 0x3b77, 0x6d02, 0xc1e5}, false, IPIDRandom},
+		{"random positive increments", []int{1000, 3500, 5200, 9000, 12345, 15000}, false, IPIDRandomInc},
+		// ICMP序列不判定RD
+		{"ICMP random", []int{0x8a1f, 0x12c4}, true, IPIDRandomInc},
+		{"constant", []int{0x2a3b, 0x2a3b, 0x2a3b}, false, "2A3B"},
+		{"unclassified", []int{100, 600, 1100, 1600}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyIPIDs(tt.ids, tt.icmp); got != tt.want {
+				t.Errorf("classifyIPIDs(%v, %v) = %q, want %q", tt.ids, tt.icmp, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharedIPIDCounter(t *testing.T) {
+	tcpIDs := []int{100, 102, 104, 106, 108, 110}
+
+	tests := []struct {
+		name     string
+		analysis *IPIDAnalysis
+		want     string
+	}{
+		{
+			// Windows的ICMP回显应答紧接着SYN/ACK的计数器
+			name:     "shared",
+			analysis: &IPIDAnalysis{TCPIDs: tcpIDs, ICMPIDs: []int{112, 113}, TI: IPIDIncremental, II: IPIDIncremental},
+			want:     IPIDSharedCounter,
+		},
+		{
+			name:     "separate counters",
+			analysis: &IPIDAnalysis{TCPIDs: tcpIDs, ICMPIDs: []int{30000, 30001}, TI: IPIDIncremental, II: IPIDIncremental},
+			want:     IPIDOtherCounter,
+		},
+		{
+			name:     "zero SYN/ACK",
+			analysis: &IPIDAnalysis{TCPIDs: []int{0, 0, 0}, ICMPIDs: []int{5, 6}, TI: IPIDZero, II: IPIDIncremental},
+			want:     "",
+		},
+		{
+			name:     "different classes",
+			analysis: &IPIDAnalysis{TCPIDs: tcpIDs, ICMPIDs: []int{0x1200, 0x1300}, TI: IPIDIncremental, II: IPIDBrokenInc},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharedIPIDCounter(tt.analysis); got != tt.want {
+				t.Errorf("sharedIPIDCounter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
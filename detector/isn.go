@@ -0,0 +1,159 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// ISN生成器类型
+const (
+	ISNClassRandom        = "random"
+	ISNClassTimeDependent = "time-dependent"
+	ISNClassConstant      = "constant"
+	ISNClass64K           = "64K increments"
+)
+
+// ISNAnalysis TCP初始序列号分析结果，GCD、ISR和SP的计算方法与nmap SEQ测试一致
+type ISNAnalysis struct {
+	ISNs  []uint32
+	GCD   uint32
+	ISR   int     // 平均增长速率的 8*log2 值
+	SP    int     // 序列号可预测性指数，增量标准差的 8*log2 值
+	Rate  float64 // 平均每秒增量
+	Class string
+}
+
+// ISNFingerprint 分析SEQ探测得到的SYN/ACK初始序列号，识别可预测的序列号生成器
+func (d *OSDetector) ISNFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	responses := d.collectSEQResponses(targetIP)
+	analysis := analyzeISN(responses)
+	if analysis == nil {
+		if d.Verbose {
+			fmt.Printf("[ISN] Not enough SYN/ACK responses (%d)\n", len(responses))
+		}
+		return resultSet
+	}
+	d.isnAnalysis = analysis
+
+	if d.Verbose {
+		fmt.Printf("[ISN] ISNs: %08x\n", analysis.ISNs)
+		fmt.Printf("[ISN] GCD=%X, ISR=%X, SP=%X, Rate=%.0f/s, Class=%s\n",
+			analysis.GCD, analysis.ISR, analysis.SP, analysis.Rate, analysis.Class)
+	}
+	d.addDetail("TCP ISN: %s, GCD=%X, ISR=%X, SP=%X", analysis.Class, analysis.GCD, analysis.ISR, analysis.SP)
+
+	if analysis.Class == ISNClassRandom {
+		// 现代主流系统都按RFC 6528随机化ISN，无法用来区分
+		return resultSet
+	}
+
+	d.addFinding("TCP初始序列号可预测（%s，GCD=%X，SP=%X），存在TCP会话劫持和盲注入风险",
+		analysis.Class, analysis.GCD, analysis.SP)
+	log.Println("目标TCP初始序列号可预测:", analysis.Class)
+
+	// Windows、Linux、BSD和Apple系统早已随机化ISN，可预测的生成器只出现在老旧嵌入式系统上
+	resultSet = newOSSet(EmbeddedFamily)
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+
+	return resultSet
+}
+
+// ISNAnalysis 返回初始序列号分析结果，未分析时为nil
+func (d *OSDetector) ISNAnalysis() *ISNAnalysis {
+	return d.isnAnalysis
+}
+
+// analyzeISN 根据SYN/ACK的序列号和发送时间计算GCD、ISR和SP，至少需要两个响应
+func analyzeISN(responses []*tcpResponse) *ISNAnalysis {
+	if len(responses) < 2 {
+		return nil
+	}
+
+	analysis := &ISNAnalysis{}
+	var diffs []uint32
+	var rates []float64
+	allZero := true
+	for i, resp := range responses {
+		analysis.ISNs = append(analysis.ISNs, resp.Seq)
+		if i == 0 {
+			continue
+		}
+		// 序列号回绕时取反向差值
+		diff := resp.Seq - responses[i-1].Seq
+		if diff > 1<<31 {
+			diff = ^diff + 1
+		}
+		if diff != 0 {
+			allZero = false
+		}
+		diffs = append(diffs, diff)
+		analysis.GCD = gcd32(analysis.GCD, diff)
+
+		elapsed := resp.Sent.Sub(responses[i-1].Sent).Seconds()
+		if elapsed <= 0 {
+			elapsed = seqProbeInterval.Seconds()
+		}
+		rates = append(rates, float64(diff)/elapsed)
+	}
+
+	var sum float64
+	for _, rate := range rates {
+		sum += rate
+	}
+	analysis.Rate = sum / float64(len(rates))
+	if analysis.Rate >= 1 {
+		analysis.ISR = int(math.Round(8 * math.Log2(analysis.Rate)))
+	}
+
+	// SP使用除以GCD之后的速率标准差
+	divisor := float64(1)
+	if analysis.GCD > 1 {
+		divisor = float64(analysis.GCD)
+	}
+	mean := analysis.Rate / divisor
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate/divisor - mean) * (rate/divisor - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(rates)))
+	if stddev > 1 {
+		analysis.SP = int(math.Round(8 * math.Log2(stddev)))
+	}
+
+	switch {
+	case allZero:
+		analysis.Class = ISNClassConstant
+	case analysis.GCD%64000 == 0:
+		analysis.Class = isn64KClass(diffs)
+	case stddev <= mean/10:
+		// 增长速率稳定，序列号由时钟驱动
+		analysis.Class = ISNClassTimeDependent
+	default:
+		analysis.Class = ISNClassRandom
+	}
+
+	return analysis
+}
+
+// isn64KClass 增量都是64000倍数时判定为64K规则，偶尔出现的大跳跃按随机处理
+func isn64KClass(diffs []uint32) string {
+	for _, diff := range diffs {
+		if diff > 64000*1000 {
+			return ISNClassRandom
+		}
+	}
+	return ISNClass64K
+}
+
+// gcd32 计算最大公约数，gcd(0, n) = n
+func gcd32(a, b uint32) uint32 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,98 @@
+package detector
+
+import (
+	"testing"
+	"time"
+)
+
+// isnTestResponses 按SEQ探测的100ms间隔构造SYN/ACK序列
+func isnTestResponses(seqs ...uint32) []*tcpResponse {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var responses []*tcpResponse
+	for i, seq := range seqs {
+		responses = append(responses, &tcpResponse{Seq: seq, Sent: start.Add(time.Duration(i) * seqProbeInterval)})
+	}
+	return responses
+}
+
+func TestAnalyzeISN(t *testing.T) {
+	tests := []struct {
+		name  string
+		seqs  []uint32
+		class string
+		gcd   uint32
+		isr   int
+	}{
+		{
+			// RFC 6528随机化的ISN
+			name:  "random",
+			seqs:  []uint32{0x1a2b3c4d, 0x9f8e7d6c, 0x0badf00d, 0x7e57c0de, 0xdeadbeef, 0x31415926},
+			class: ISNClassRandom,
+			gcd:   1,
+			isr:   0x110,
+		},
+		{
+			name:  "constant",
+			seqs:  []uint32{0x12345678, 0x12345678, 0x12345678, 0x12345678, 0x12345678, 0x12345678},
+			class: ISNClassConstant,
+		},
+		{
+			// 每个连接增加64000，nmap中的GCD=FA00，ISR = round(8*log2(640000)) = 0x9A
+			name:  "64K increments",
+			seqs:  []uint32{64000, 128000, 192000, 256000, 320000, 384000},
+			class: ISNClass64K,
+			gcd:   64000,
+			isr:   0x9a,
+		},
+		{
+			// 按250KHz时钟递增，ISR = round(8*log2(250000)) = 0x8F
+			name:  "time-dependent",
+			seqs:  []uint32{1000000, 1025000, 1050010, 1075000, 1099990, 1125000},
+			class: ISNClassTimeDependent,
+			gcd:   10,
+			isr:   0x8f,
+		},
+		{
+			// 序列号跨越2^32回绕时仍按正增量计算
+			name:  "time-dependent wraparound",
+			seqs:  []uint32{0xfffe0000, 0xffff0000, 0x00000000, 0x00010000, 0x00020000, 0x00030000},
+			class: ISNClassTimeDependent,
+			gcd:   0x10000,
+			isr:   0x9b,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := analyzeISN(isnTestResponses(tt.seqs...))
+			if analysis == nil {
+				t.Fatal("analyzeISN() = nil")
+			}
+			if analysis.Class != tt.class || analysis.GCD != tt.gcd || analysis.ISR != tt.isr {
+				t.Errorf("analyzeISN() = Class %q, GCD %X, ISR %X; want %q, %X, %X",
+					analysis.Class, analysis.GCD, analysis.ISR, tt.class, tt.gcd, tt.isr)
+			}
+			if len(analysis.ISNs) != len(tt.seqs) {
+				t.Errorf("ISNs = %d entries, want %d", len(analysis.ISNs), len(tt.seqs))
+			}
+		})
+	}
+
+	if analysis := analyzeISN(isnTestResponses(1)); analysis != nil {
+		t.Errorf("analyzeISN() with one response = %+v, want nil", analysis)
+	}
+}
+
+func TestGCD32(t *testing.T) {
+	tests := []struct{ a, b, want uint32 }{
+		{0, 64000, 64000},
+		{64000, 128000, 64000},
+		{25000, 25010, 10},
+		{7, 13, 1},
+	}
+	for _, tt := range tests {
+		if got := gcd32(tt.a, tt.b); got != tt.want {
+			t.Errorf("gcd32(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kerberos 消息类型和ASN.1标签
+const (
+	krbMsgASReq       = 10
+	krbTagASReq       = 0x6a // [APPLICATION 10]
+	krbTagError       = 0x7e // [APPLICATION 30]
+	krbTagGeneralStr  = 0x1b
+	krbTagGenTime     = 0x18
+	krbTagBitString   = 0x03
+	krbNTPrincipal    = 1
+	krbNTSrvInst      = 2
+	krbKDCOptions     = 0x40810010 // forwardable, renewable, canonicalize, renewable-ok
+	krbTimeLayout     = "20060102150405Z"
+	krbDefaultRealm   = "WORKGROUP"
+	krbPrincipalChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Kerberos 错误码
+const (
+	krbErrCPrincipalUnknown = 6
+	krbErrPreauthRequired   = 25
+	krbErrWrongRealm        = 68
+)
+
+// Kerberos 预认证数据类型
+const (
+	krbPAEtypeInfo  = 11
+	krbPAEtypeInfo2 = 19
+	krbPAFXFast     = 136 // RFC 6113 FAST，Windows Server 2012开始支持
+)
+
+// krbErrTypeExtended MS-KILE KERB-ERROR-DATA中表示KERB-EXT-ERROR的data-type
+const krbErrTypeExtended = 3
+
+// krbEtypes AS-REQ中声明支持的加密类型
+var krbEtypes = []int64{18, 17, 23, 24, -135, 3, 1}
+
+// krbEtypeNames 常见加密类型名称
+var krbEtypeNames = map[int]string{
+	1:  "des-cbc-crc",
+	3:  "des-cbc-md5",
+	17: "aes128-cts-hmac-sha1-96",
+	18: "aes256-cts-hmac-sha1-96",
+	19: "aes128-cts-hmac-sha256-128",
+	20: "aes256-cts-hmac-sha384-192",
+	23: "rc4-hmac",
+	24: "rc4-hmac-exp",
+}
+
+// KerberosInfo KDC返回的KRB-ERROR信息
+type KerberosInfo struct {
+	Implementation string // Active Directory、MIT或Heimdal
+	ErrorCode      int
+	Realm          string
+	ServerTime     time.Time
+	ClockSkew      time.Duration // 服务器时间减去本地时间
+	EText          string
+	PATypes        []int  // e-data中的预认证数据类型
+	Etypes         []int  // ETYPE-INFO/ETYPE-INFO2中的加密类型
+	NTStatus       uint32 // Active Directory在KERB-EXT-ERROR中返回的NTSTATUS
+}
+
+// KerberosFingerprint 通过不存在主体的AS-REQ错误响应识别KDC实现和时钟偏差
+func (d *OSDetector) KerberosFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	realm := d.kerberosRealm()
+	request := krbASRequest(krbRandomPrincipal(), realm)
+
+	sent := time.Now()
+	response, err := krbExchangeTCP(targetIP, request)
+	if err != nil {
+		response, err = udpExchange(targetIP, 88, request)
+	}
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Kerberos] No response: %v\n", err)
+		}
+		return resultSet
+	}
+	// 以请求往返的中点作为本地参考时间
+	local := sent.Add(time.Since(sent) / 2)
+
+	info, err := parseKRBError(response)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Kerberos] Invalid response: %v\n", err)
+		}
+		return resultSet
+	}
+	info.ClockSkew = info.ServerTime.Sub(local).Round(time.Millisecond)
+	info.Implementation = identifyKDC(info)
+	d.kerberosInfo = info
+
+	var etypes []string
+	for _, etype := range info.Etypes {
+		if name, ok := krbEtypeNames[etype]; ok {
+			etypes = append(etypes, name)
+		} else {
+			etypes = append(etypes, fmt.Sprint(etype))
+		}
+	}
+	if d.Verbose {
+		fmt.Printf("[Kerberos] Realm: %s (requested %s), Error: %d, E-text: %q\n", info.Realm, realm, info.ErrorCode, info.EText)
+		fmt.Printf("[Kerberos] Server time: %s, Clock skew: %s, PA types: %v, Etypes: %v, NTSTATUS: %#08x\n",
+			info.ServerTime.Format(time.RFC3339), info.ClockSkew, info.PATypes, etypes, info.NTStatus)
+	}
+	d.addDetail("Kerberos: %s KDC, realm %s, error %d, clock skew %s", info.Implementation, info.Realm, info.ErrorCode, info.ClockSkew)
+
+	switch info.Implementation {
+	case "Active Directory":
+		resultSet = newOSSet(WindowsServerFamily)
+		// Windows Server 2003的KDC不支持AES
+		for _, etype := range info.Etypes {
+			if etype == 17 || etype == 18 {
+				delete(resultSet, "Windows Server 2003")
+			}
+		}
+		// FAST从Windows Server 2012开始支持，启用Kerberos armoring的KDC会在METHOD-DATA中通告PA-FX-FAST
+		if slices.Contains(info.PATypes, krbPAFXFast) {
+			delete(resultSet, "Windows Server 2003")
+			delete(resultSet, "Windows Server 2008")
+			log.Println("KDC通告PA-FX-FAST，至少为Windows Server 2012")
+		}
+		log.Println("Kerberos错误响应具有Active Directory KDC特征")
+	case "Heimdal":
+		// FreeBSD基本系统自带Heimdal
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		d.osWeights["FreeBSD"]++
+		log.Println("Kerberos错误响应具有Heimdal KDC特征")
+	case "MIT":
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		for _, os := range LinuxFamily {
+			d.osWeights[os]++
+		}
+		log.Println("Kerberos错误响应具有MIT KDC特征")
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+
+	return resultSet
+}
+
+// KerberosInfo 返回Kerberos KDC错误响应信息，未探测或无响应时为nil
+func (d *OSDetector) KerberosInfo() *KerberosInfo {
+	return d.kerberosInfo
+}
+
+// ClockSkew 返回Kerberos探测得到的目标时钟偏差
+func (d *OSDetector) ClockSkew() (time.Duration, bool) {
+	if d.kerberosInfo == nil {
+		return 0, false
+	}
+	return d.kerberosInfo.ClockSkew, true
+}
+
+// kerberosRealm 从之前探测得到的LDAP和NTLM信息中推断Kerberos领域
+func (d *OSDetector) kerberosRealm() string {
+	if d.ldapInfo != nil {
+		var parts []string
+		for _, rdn := range strings.Split(d.ldapInfo.DefaultNamingContext, ",") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(rdn), "="); ok && strings.EqualFold(k, "DC") {
+				parts = append(parts, v)
+			}
+		}
+		if len(parts) > 0 {
+			return strings.ToUpper(strings.Join(parts, "."))
+		}
+	}
+	for _, challenge := range []*NTLMChallengeInfo{d.rdpNTLM(), d.winrmNTLM()} {
+		if challenge != nil && challenge.DNSDomain != "" {
+			return strings.ToUpper(challenge.DNSDomain)
+		}
+	}
+	return krbDefaultRealm
+}
+
+// rdpNTLM 返回RDP探测得到的NTLM Challenge
+func (d *OSDetector) rdpNTLM() *NTLMChallengeInfo {
+	if d.rdpInfo == nil {
+		return nil
+	}
+	return d.rdpInfo.NTLM
+}
+
+// winrmNTLM 返回WinRM探测得到的NTLM Challenge
+func (d *OSDetector) winrmNTLM() *NTLMChallengeInfo {
+	if d.winrmInfo == nil {
+		return nil
+	}
+	return d.winrmInfo.NTLM
+}
+
+// krbRandomPrincipal 生成一个几乎不可能存在的用户名
+func krbRandomPrincipal() string {
+	name := make([]byte, 12)
+	for i := range name {
+		name[i] = krbPrincipalChars[rand.Intn(len(krbPrincipalChars))]
+	}
+	return "osd" + string(name)
+}
+
+// krbASRequest 构造不携带预认证数据的AS-REQ
+func krbASRequest(user, realm string) []byte {
+	generalString := func(s string) []byte { return berTLV(krbTagGeneralStr, []byte(s)) }
+	principal := func(nameType int64, names ...string) []byte {
+		var parts [][]byte
+		for _, name := range names {
+			parts = append(parts, generalString(name))
+		}
+		return berSequence(berTagSequence,
+			berSequence(0xa0, berInteger(berTagInteger, nameType)),
+			berSequence(0xa1, berSequence(berTagSequence, parts...)),
+		)
+	}
+
+	var etypes [][]byte
+	for _, etype := range krbEtypes {
+		etypes = append(etypes, berInteger(berTagInteger, etype))
+	}
+	options := binary.BigEndian.AppendUint32([]byte{0}, krbKDCOptions)
+
+	body := berSequence(berTagSequence,
+		berSequence(0xa0, berTLV(krbTagBitString, options)),
+		berSequence(0xa1, principal(krbNTPrincipal, user)),
+		berSequence(0xa2, generalString(realm)),
+		berSequence(0xa3, principal(krbNTSrvInst, "krbtgt", realm)),
+		berSequence(0xa5, berTLV(krbTagGenTime, []byte("20370913024805Z"))),
+		berSequence(0xa7, berInteger(berTagInteger, int64(rand.Int31()))),
+		berSequence(0xa8, berSequence(berTagSequence, etypes...)),
+	)
+	return berSequence(krbTagASReq, berSequence(berTagSequence,
+		berSequence(0xa1, berInteger(berTagInteger, 5)),
+		berSequence(0xa2, berInteger(berTagInteger, krbMsgASReq)),
+		berSequence(0xa4, body),
+	))
+}
+
+// krbExchangeTCP 通过TCP发送带4字节长度前缀的Kerberos消息
+func krbExchangeTCP(targetIP string, request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "88"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(request))), request...)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > 1<<16 {
+		return nil, fmt.Errorf("Kerberos response too large")
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// parseKRBError 解析KRB-ERROR消息
+func parseKRBError(data []byte) (*KerberosInfo, error) {
+	outer, _, err := parseBER(data)
+	if err != nil {
+		return nil, err
+	}
+	if outer.Tag != krbTagError {
+		return nil, fmt.Errorf("not a KRB-ERROR message (tag %#02x)", outer.Tag)
+	}
+	seq, _, err := parseBER(outer.Value)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := seq.children()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &KerberosInfo{}
+	var susec int64
+	for _, field := range fields {
+		inner, _, err := parseBER(field.Value)
+		if err != nil {
+			continue
+		}
+		switch field.Tag {
+		case 0xa4: // stime
+			info.ServerTime, _ = time.Parse(krbTimeLayout, string(inner.Value))
+		case 0xa5: // susec
+			susec = inner.int()
+		case 0xa6: // error-code
+			info.ErrorCode = int(inner.int())
+		case 0xa9: // realm
+			info.Realm = string(inner.Value)
+		case 0xab: // e-text
+			info.EText = string(inner.Value)
+		case 0xac: // e-data
+			info.parseEData(inner.Value)
+		}
+	}
+	if info.ServerTime.IsZero() {
+		return nil, fmt.Errorf("KRB-ERROR without server time")
+	}
+	info.ServerTime = info.ServerTime.Add(time.Duration(susec) * time.Microsecond)
+
+	return info, nil
+}
+
+// parseEData 解析e-data，MIT和Heimdal返回METHOD-DATA（PA-DATA序列），
+// Active Directory返回单个KERB-ERROR-DATA
+func (info *KerberosInfo) parseEData(data []byte) {
+	seq, _, err := parseBER(data)
+	if err != nil || seq.Tag != berTagSequence {
+		return
+	}
+	entries, _ := seq.children()
+	if len(entries) > 0 && entries[0].Tag == 0xa1 {
+		info.parseKerbErrorData(entries)
+		return
+	}
+	for _, entry := range entries {
+		fields, _ := entry.children()
+		paType, paValue := krbTypedValue(fields)
+		if paType < 0 {
+			continue
+		}
+		info.PATypes = append(info.PATypes, paType)
+
+		switch paType {
+		case krbPAEtypeInfo, krbPAEtypeInfo2:
+			infoSeq, _, err := parseBER(paValue)
+			if err != nil {
+				continue
+			}
+			etypeEntries, _ := infoSeq.children()
+			for _, etypeEntry := range etypeEntries {
+				etypeFields, _ := etypeEntry.children()
+				if len(etypeFields) > 0 && etypeFields[0].Tag == 0xa0 {
+					if etype, _, err := parseBER(etypeFields[0].Value); err == nil {
+						info.Etypes = append(info.Etypes, int(etype.int()))
+					}
+				}
+			}
+		}
+	}
+}
+
+// parseKerbErrorData 解析MS-KILE KERB-ERROR-DATA：SEQUENCE { data-type [1] INTEGER, data-value [2] OCTET STRING }，
+// data-type为KERB_ERR_TYPE_EXTENDED时data-value是KERB-EXT-ERROR：NTSTATUS、保留字段和标志
+func (info *KerberosInfo) parseKerbErrorData(fields []berElement) {
+	dataType, dataValue := krbTypedValue(fields)
+	if dataType == krbErrTypeExtended && len(dataValue) >= 12 {
+		info.NTStatus = binary.LittleEndian.Uint32(dataValue)
+	}
+}
+
+// krbTypedValue 从 [1] INTEGER、[2] OCTET STRING 结构中取出类型和值，
+// PA-DATA和KERB-ERROR-DATA使用相同的编码，没有类型时返回-1
+func krbTypedValue(fields []berElement) (int, []byte) {
+	dataType := -1
+	var value []byte
+	for _, field := range fields {
+		inner, _, err := parseBER(field.Value)
+		if err != nil {
+			continue
+		}
+		switch field.Tag {
+		case 0xa1:
+			dataType = int(inner.int())
+		case 0xa2:
+			value = inner.Value
+		}
+	}
+	return dataType, value
+}
+
+// identifyKDC 根据错误文本和e-data判断KDC实现
+func identifyKDC(info *KerberosInfo) string {
+	switch {
+	case info.NTStatus&0xc0000000 == 0xc0000000:
+		return "Active Directory"
+	case containsIgnoreCase(info.EText, "hdb") || containsIgnoreCase(info.EText, "no such entry"):
+		return "Heimdal"
+	case strings.Contains(info.EText, "CLIENT_NOT_FOUND") || containsIgnoreCase(info.EText, "not found in Kerberos database") ||
+		strings.Contains(info.EText, "WRONG_REALM") || strings.Contains(info.EText, "NEEDED_PREAUTH"):
+		return "MIT"
+	case info.EText == "" && (info.ErrorCode == krbErrCPrincipalUnknown || info.ErrorCode == krbErrWrongRealm ||
+		info.ErrorCode == krbErrPreauthRequired) && info.Realm == strings.ToUpper(info.Realm):
+		// Active Directory不返回错误文本，领域名总是大写
+		return "Active Directory"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,172 @@
+package detector
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+)
+
+// krbTestError 构造KRB-ERROR消息，eData为nil时省略e-data字段
+func krbTestError(errorCode int64, realm, eText string, eData []byte) []byte {
+	fields := [][]byte{
+		berSequence(0xa0, berInteger(berTagInteger, 5)),
+		berSequence(0xa1, berInteger(berTagInteger, 30)),
+		berSequence(0xa4, berTLV(krbTagGenTime, []byte("20240501120000Z"))),
+		berSequence(0xa5, berInteger(berTagInteger, 250000)),
+		berSequence(0xa6, berInteger(berTagInteger, errorCode)),
+		berSequence(0xa9, berTLV(krbTagGeneralStr, []byte(realm))),
+	}
+	if eText != "" {
+		fields = append(fields, berSequence(0xab, berTLV(krbTagGeneralStr, []byte(eText))))
+	}
+	if eData != nil {
+		fields = append(fields, berSequence(0xac, berTLV(berTagOctetString, eData)))
+	}
+	return berSequence(krbTagError, berSequence(berTagSequence, fields...))
+}
+
+// krbTestPAData 构造PA-DATA：SEQUENCE { padata-type [1] INTEGER, padata-value [2] OCTET STRING }
+func krbTestPAData(paType int64, value []byte) []byte {
+	return berSequence(berTagSequence,
+		berSequence(0xa1, berInteger(berTagInteger, paType)),
+		berSequence(0xa2, berTLV(berTagOctetString, value)),
+	)
+}
+
+func TestParseKRBError(t *testing.T) {
+	// MIT KDC要求预认证时在METHOD-DATA中返回ETYPE-INFO2
+	etypeInfo2 := berSequence(berTagSequence,
+		berSequence(berTagSequence, berSequence(0xa0, berInteger(berTagInteger, 18))),
+		berSequence(berTagSequence, berSequence(0xa0, berInteger(berTagInteger, 17))),
+	)
+	methodData := berSequence(berTagSequence,
+		krbTestPAData(krbPAEtypeInfo2, etypeInfo2),
+		krbTestPAData(2, nil), // PA-ENC-TIMESTAMP
+	)
+	// Active Directory在e-data中返回KERB-ERROR-DATA，KERB-EXT-ERROR中的NTSTATUS为STATUS_NO_SUCH_USER
+	extError := binary.LittleEndian.AppendUint32(nil, 0xc0000064)
+	extError = append(extError, 0, 0, 0, 0, 1, 0, 0, 0)
+	kerbErrorData := func(dataType int64, value []byte) []byte {
+		return berSequence(berTagSequence,
+			berSequence(0xa1, berInteger(berTagInteger, dataType)),
+			berSequence(0xa2, berTLV(berTagOctetString, value)),
+		)
+	}
+	// 启用FAST的Windows Server 2012+ KDC要求预认证时通告PA-FX-FAST
+	fastMethodData := berSequence(berTagSequence,
+		krbTestPAData(krbPAFXFast, nil),
+		krbTestPAData(krbPAEtypeInfo2, etypeInfo2),
+	)
+	stime := time.Date(2024, 5, 1, 12, 0, 0, 250000000, time.UTC)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   bool
+		errorCode int
+		realm     string
+		eText     string
+		paTypes   []int
+		etypes    []int
+		ntStatus  uint32
+	}{
+		{
+			name:      "MIT principal unknown",
+			data:      krbTestError(krbErrCPrincipalUnknown, "EXAMPLE.COM", "CLIENT_NOT_FOUND", nil),
+			errorCode: krbErrCPrincipalUnknown,
+			realm:     "EXAMPLE.COM",
+			eText:     "CLIENT_NOT_FOUND",
+		},
+		{
+			name:      "MIT preauth required",
+			data:      krbTestError(krbErrPreauthRequired, "EXAMPLE.COM", "NEEDED_PREAUTH", methodData),
+			errorCode: krbErrPreauthRequired,
+			realm:     "EXAMPLE.COM",
+			eText:     "NEEDED_PREAUTH",
+			paTypes:   []int{krbPAEtypeInfo2, 2},
+			etypes:    []int{18, 17},
+		},
+		{
+			name:      "AD principal unknown",
+			data:      krbTestError(krbErrCPrincipalUnknown, "CORP.EXAMPLE.COM", "", kerbErrorData(krbErrTypeExtended, extError)),
+			errorCode: krbErrCPrincipalUnknown,
+			realm:     "CORP.EXAMPLE.COM",
+			ntStatus:  0xc0000064,
+		},
+		{
+			name:      "AD unknown data-type",
+			data:      krbTestError(krbErrCPrincipalUnknown, "CORP.EXAMPLE.COM", "", kerbErrorData(2, extError)),
+			errorCode: krbErrCPrincipalUnknown,
+			realm:     "CORP.EXAMPLE.COM",
+		},
+		{
+			name:      "AD truncated KERB-EXT-ERROR",
+			data:      krbTestError(krbErrCPrincipalUnknown, "CORP.EXAMPLE.COM", "", kerbErrorData(krbErrTypeExtended, extError[:4])),
+			errorCode: krbErrCPrincipalUnknown,
+			realm:     "CORP.EXAMPLE.COM",
+		},
+		{
+			name:      "AD preauth required with FAST",
+			data:      krbTestError(krbErrPreauthRequired, "CORP.EXAMPLE.COM", "", fastMethodData),
+			errorCode: krbErrPreauthRequired,
+			realm:     "CORP.EXAMPLE.COM",
+			paTypes:   []int{krbPAFXFast, krbPAEtypeInfo2},
+			etypes:    []int{18, 17},
+		},
+		{name: "AS-REQ", data: krbASRequest("user", "EXAMPLE.COM"), wantErr: true},
+		{name: "no server time", data: berSequence(krbTagError, berSequence(berTagSequence)), wantErr: true},
+		{name: "truncated", data: []byte{krbTagError, 0x82, 0x01}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseKRBError(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseKRBError() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKRBError() error: %v", err)
+			}
+			if info.ErrorCode != tt.errorCode || info.Realm != tt.realm || info.EText != tt.eText {
+				t.Errorf("parseKRBError() = error %d, realm %q, e-text %q, want error %d, realm %q, e-text %q",
+					info.ErrorCode, info.Realm, info.EText, tt.errorCode, tt.realm, tt.eText)
+			}
+			if !info.ServerTime.Equal(stime) {
+				t.Errorf("ServerTime = %s, want %s", info.ServerTime, stime)
+			}
+			if !slices.Equal(info.PATypes, tt.paTypes) || !slices.Equal(info.Etypes, tt.etypes) {
+				t.Errorf("PATypes = %v, Etypes = %v, want %v, %v", info.PATypes, info.Etypes, tt.paTypes, tt.etypes)
+			}
+			if info.NTStatus != tt.ntStatus {
+				t.Errorf("NTStatus = %#08x, want %#08x", info.NTStatus, tt.ntStatus)
+			}
+		})
+	}
+}
+
+func TestIdentifyKDC(t *testing.T) {
+	tests := []struct {
+		name string
+		info *KerberosInfo
+		want string
+	}{
+		{"AD NTSTATUS", &KerberosInfo{ErrorCode: krbErrCPrincipalUnknown, Realm: "CORP.EXAMPLE.COM", NTStatus: 0xc0000064}, "Active Directory"},
+		{"AD without e-text", &KerberosInfo{ErrorCode: krbErrCPrincipalUnknown, Realm: "CORP.EXAMPLE.COM"}, "Active Directory"},
+		{"Heimdal", &KerberosInfo{ErrorCode: krbErrCPrincipalUnknown, Realm: "EXAMPLE.COM", EText: "no such entry found in hdb"}, "Heimdal"},
+		{"MIT", &KerberosInfo{ErrorCode: krbErrCPrincipalUnknown, Realm: "EXAMPLE.COM", EText: "CLIENT_NOT_FOUND"}, "MIT"},
+		{"MIT wrong realm", &KerberosInfo{ErrorCode: krbErrWrongRealm, Realm: "EXAMPLE.COM", EText: "WRONG_REALM"}, "MIT"},
+		{"lowercase realm", &KerberosInfo{ErrorCode: krbErrCPrincipalUnknown, Realm: "example.com"}, "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifyKDC(tt.info); got != tt.want {
+				t.Errorf("identifyKDC() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package detector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// LDAPPorts 依次尝试的LDAP、全局编录和LDAPS端口
+var LDAPPorts = []int{389, 3268, 636}
+
+// LDAP 协议操作标签
+const (
+	ldapSearchRequest   = 0x63
+	ldapSearchResEntry  = 0x64
+	ldapSearchResDone   = 0x65
+	ldapFilterPresent   = 0x87
+	ldapScopeBaseObject = 0
+)
+
+// Active Directory 在rootDSE的supportedCapabilities中声明的能力
+const (
+	ldapCapActiveDirectory = "1.2.840.113556.1.4.800"
+	ldapCapADAM            = "1.2.840.113556.1.4.1851" // AD LDS
+	ldapCapADV51           = "1.2.840.113556.1.4.1670" // Windows Server 2003
+	ldapCapADV60           = "1.2.840.113556.1.4.1935" // Windows Server 2008
+	ldapCapADV61R2         = "1.2.840.113556.1.4.2080" // Windows Server 2008 R2
+	ldapCapADW8            = "1.2.840.113556.1.4.2237" // Windows Server 2012
+)
+
+// ldapRootDSEAttributes 请求的rootDSE属性
+var ldapRootDSEAttributes = []string{
+	"domainControllerFunctionality", "forestFunctionality", "domainFunctionality",
+	"supportedCapabilities", "dnsHostName", "defaultNamingContext",
+	"vendorName", "vendorVersion", "objectClass",
+}
+
+// ldapDCFunctionality 域控制器功能级别对应的最高Windows Server版本
+// 级别7由Windows Server 2016、2019和2022共用
+var ldapDCFunctionality = map[int][]string{
+	2:  {"Windows Server 2003"},
+	3:  {"Windows Server 2008"},
+	4:  {"Windows Server 2008"}, // 2008 R2
+	5:  {"Windows Server 2012"},
+	6:  {"Windows Server 2012"}, // 2012 R2
+	7:  {"Windows Server 2016", "Windows Server 2019", "Windows Server 2022"},
+	10: {"Windows Server 2025"},
+}
+
+// LDAPRootDSEInfo 匿名读取的rootDSE信息
+type LDAPRootDSEInfo struct {
+	Port                 int
+	DCFunctionality      int // -1表示未返回
+	ForestFunctionality  int
+	DomainFunctionality  int
+	Capabilities         []string
+	DNSHostName          string
+	DefaultNamingContext string
+	VendorName           string
+	VendorVersion        string
+	ObjectClasses        []string
+}
+
+// LDAPFingerprint 通过匿名rootDSE查询识别域控制器版本和LDAP服务器实现
+func (d *OSDetector) LDAPFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	var info *LDAPRootDSEInfo
+	for _, port := range LDAPPorts {
+		var err error
+		if info, err = ldapSearchRootDSE(targetIP, port); err == nil {
+			break
+		}
+		if d.Verbose {
+			fmt.Printf("[LDAP] Port %d: %v\n", port, err)
+		}
+	}
+	if info == nil {
+		return resultSet
+	}
+	d.ldapInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[LDAP] Port: %d, DNSHostName: %s, NamingContext: %s\n", info.Port, info.DNSHostName, info.DefaultNamingContext)
+		fmt.Printf("[LDAP] Functionality DC/Domain/Forest: %d/%d/%d, Vendor: %s %s\n",
+			info.DCFunctionality, info.DomainFunctionality, info.ForestFunctionality, info.VendorName, info.VendorVersion)
+		fmt.Printf("[LDAP] Capabilities: %v\n", info.Capabilities)
+	}
+
+	switch {
+	case containsIgnoreCase(info.VendorName, "samba"):
+		// Samba AD DC同样声明Active Directory能力，但会在vendorName中标明
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		d.addDetail("LDAP: Samba AD DC %s (%s)", info.VendorVersion, info.DNSHostName)
+		log.Println("LDAP rootDSE显示目标为Samba域控制器")
+	case info.hasCapability(ldapCapActiveDirectory):
+		resultSet = info.adOSSet()
+		d.addDetail("LDAP: Active Directory DC functionality %d, forest %d (%s)",
+			info.DCFunctionality, info.ForestFunctionality, info.DNSHostName)
+		log.Println("LDAP rootDSE显示目标为Active Directory域控制器:", info.DNSHostName)
+	case info.hasCapability(ldapCapADAM):
+		// AD LDS也可以安装在桌面版Windows上
+		resultSet = newOSSet(WindowsFamily)
+		d.addDetail("LDAP: AD LDS (%s)", info.DNSHostName)
+	case containsIgnoreCase(info.VendorName, "389 project") || containsIgnoreCase(info.VendorName, "red hat") ||
+		containsIgnoreCase(info.VendorVersion, "389-directory"):
+		resultSet = osSetFromVersionString(info.VendorVersion)
+		if len(resultSet) == 0 {
+			resultSet = newOSSet(LinuxFamily)
+		}
+		d.addDetail("LDAP: 389 Directory Server %s", info.VendorVersion)
+	case info.hasObjectClass("OpenLDAProotDSE") || containsIgnoreCase(info.VendorName, "openldap"):
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		d.addDetail("LDAP: OpenLDAP")
+	default:
+		d.addDetail("LDAP: %s %s", info.VendorName, info.VendorVersion)
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 4
+	}
+
+	return resultSet
+}
+
+// LDAPRootDSEInfo 返回LDAP rootDSE信息，未探测或无响应时为nil
+func (d *OSDetector) LDAPRootDSEInfo() *LDAPRootDSEInfo {
+	return d.ldapInfo
+}
+
+// adOSSet 根据域控制器功能级别或能力OID确定Windows Server版本
+func (info *LDAPRootDSEInfo) adOSSet() map[string]bool {
+	if versions, ok := ldapDCFunctionality[info.DCFunctionality]; ok {
+		return newOSSet(versions)
+	}
+
+	// 没有功能级别时，根据最高的能力OID确定最低版本
+	minimum := "Windows Server 2003"
+	for _, c := range []struct{ oid, os string }{
+		{ldapCapADV51, "Windows Server 2003"},
+		{ldapCapADV60, "Windows Server 2008"},
+		{ldapCapADV61R2, "Windows Server 2008"},
+		{ldapCapADW8, "Windows Server 2012"},
+	} {
+		if info.hasCapability(c.oid) {
+			minimum = c.os
+		}
+	}
+	resultSet := make(map[string]bool)
+	found := false
+	for _, os := range WindowsServerFamily {
+		found = found || os == minimum
+		if found {
+			resultSet[os] = true
+		}
+	}
+	return resultSet
+}
+
+// ldapSearchRootDSE 匿名绑定并对空DN进行base范围的搜索
+func ldapSearchRootDSE(targetIP string, port int) (*LDAPRootDSEInfo, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, strconv.Itoa(port)), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if port == 636 {
+		conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	// LDAPv3允许不绑定直接以匿名身份搜索rootDSE
+	var attributes [][]byte
+	for _, attr := range ldapRootDSEAttributes {
+		attributes = append(attributes, berTLV(berTagOctetString, []byte(attr)))
+	}
+	request := berSequence(berTagSequence,
+		berInteger(berTagInteger, 1),
+		berSequence(ldapSearchRequest,
+			berTLV(berTagOctetString, nil),
+			berInteger(berTagEnumerated, ldapScopeBaseObject),
+			berInteger(berTagEnumerated, 0), // neverDerefAliases
+			berInteger(berTagInteger, 0),    // sizeLimit
+			berInteger(berTagInteger, MaxRTT),
+			berTLV(berTagBoolean, []byte{0}),
+			berTLV(ldapFilterPresent, []byte("objectClass")),
+			berSequence(berTagSequence, attributes...),
+		),
+	)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	info := &LDAPRootDSEInfo{Port: port, DCFunctionality: -1, ForestFunctionality: -1, DomainFunctionality: -1}
+	gotEntry := false
+	for {
+		message, err := ldapReadMessage(conn)
+		if err != nil {
+			if gotEntry {
+				return info, nil
+			}
+			return nil, err
+		}
+		elems, err := message.children()
+		if err != nil || len(elems) < 2 {
+			return nil, fmt.Errorf("invalid LDAP message")
+		}
+		op := elems[1]
+		switch op.Tag {
+		case ldapSearchResEntry:
+			gotEntry = true
+			info.parseEntry(op)
+		case ldapSearchResDone:
+			if !gotEntry {
+				return nil, fmt.Errorf("rootDSE search returned no entry")
+			}
+			return info, nil
+		}
+	}
+}
+
+// parseEntry 解析SearchResultEntry中的属性
+func (info *LDAPRootDSEInfo) parseEntry(entry berElement) {
+	parts, err := entry.children()
+	if err != nil || len(parts) < 2 {
+		return
+	}
+	attributes, _ := parts[1].children()
+	for _, attribute := range attributes {
+		fields, err := attribute.children()
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		values, _ := fields[1].children()
+		if len(values) == 0 {
+			continue
+		}
+		first := string(values[0].Value)
+
+		switch string(fields[0].Value) {
+		case "domainControllerFunctionality":
+			info.DCFunctionality, _ = strconv.Atoi(first)
+		case "forestFunctionality":
+			info.ForestFunctionality, _ = strconv.Atoi(first)
+		case "domainFunctionality":
+			info.DomainFunctionality, _ = strconv.Atoi(first)
+		case "dnsHostName":
+			info.DNSHostName = first
+		case "defaultNamingContext":
+			info.DefaultNamingContext = first
+		case "vendorName":
+			info.VendorName = first
+		case "vendorVersion":
+			info.VendorVersion = first
+		case "supportedCapabilities":
+			for _, v := range values {
+				info.Capabilities = append(info.Capabilities, string(v.Value))
+			}
+		case "objectClass":
+			for _, v := range values {
+				info.ObjectClasses = append(info.ObjectClasses, string(v.Value))
+			}
+		}
+	}
+}
+
+// ldapReadMessage 从连接中读取一个完整的LDAPMessage
+func ldapReadMessage(conn net.Conn) (berElement, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return berElement{}, err
+	}
+	if header[0] != berTagSequence {
+		return berElement{}, fmt.Errorf("not an LDAP message")
+	}
+
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return berElement{}, fmt.Errorf("invalid BER length")
+		}
+		lengthBytes := make([]byte, n)
+		if _, err := io.ReadFull(conn, lengthBytes); err != nil {
+			return berElement{}, err
+		}
+		header = append(header, lengthBytes...)
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		length = 0
+		for _, b := range header[2:] {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 1<<20 {
+		return berElement{}, fmt.Errorf("LDAP message too large")
+	}
+
+	elem := berElement{Tag: header[0], Value: make([]byte, length)}
+	if _, err := io.ReadFull(conn, elem.Value); err != nil {
+		return berElement{}, err
+	}
+	return elem, nil
+}
+
+// hasCapability 检查rootDSE是否声明了指定能力
+func (info *LDAPRootDSEInfo) hasCapability(oid string) bool {
+	for _, c := range info.Capabilities {
+		if c == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// hasObjectClass 检查rootDSE的objectClass
+func (info *LDAPRootDSEInfo) hasObjectClass(class string) bool {
+	for _, c := range info.ObjectClasses {
+		if containsIgnoreCase(c, class) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// LLMNRInfo LLMNR响应信息
+type LLMNRInfo struct {
+	Query    string // 得到响应的查询名称
+	Hostname string // PTR应答中的主机名
+	Answers  int
+}
+
+// LLMNRFingerprint 使用存活检测阶段的LLMNR响应或重新查询，将响应作为Windows系列的证据
+func (d *OSDetector) LLMNRFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	info := d.llmnrInfo
+	if info == nil {
+		var err error
+		if info, err = d.llmnrProbe(targetIP); err != nil {
+			if d.Verbose {
+				fmt.Printf("[LLMNR] No response: %v\n", err)
+			}
+			return resultSet
+		}
+		d.llmnrInfo = info
+	}
+
+	if d.Verbose {
+		fmt.Printf("[LLMNR] Query: %s, Hostname: %s, Answers: %d\n", info.Query, info.Hostname, info.Answers)
+	}
+	d.addDetail("LLMNR: %s answered for %s", info.Hostname, info.Query)
+
+	// LLMNR从Windows Vista/Server 2008开始支持，systemd-resolved默认也会响应，因此保留Linux
+	resultSet = newOSSet(WindowsFamily)
+	delete(resultSet, "Windows XP")
+	delete(resultSet, "Windows Server 2003")
+	for os := range resultSet {
+		d.osWeights[os] += 2
+	}
+	for _, os := range LinuxFamily {
+		resultSet[os] = true
+	}
+	log.Println("目标响应LLMNR查询，可能是Windows系统或启用了systemd-resolved的Linux")
+
+	return resultSet
+}
+
+// LLMNRInfo 返回LLMNR响应信息，未探测或无响应时为nil
+func (d *OSDetector) LLMNRInfo() *LLMNRInfo {
+	return d.llmnrInfo
+}
+
+// llmnrProbe 依次查询目标地址的反向名称和已知的NetBIOS计算机名
+func (d *OSDetector) llmnrProbe(targetIP string) (*LLMNRInfo, error) {
+	var queries []dnsQuery
+	if reverse, err := mdnsReverseName(targetIP); err == nil {
+		queries = append(queries, dnsQuery{Opcode: dnsOpcodeQuery, Name: reverse, Type: dnsTypePTR, Class: dnsClassIN, EDNS: -1})
+	}
+	if d.netbiosInfo != nil && d.netbiosInfo.ComputerName != "" {
+		queries = append(queries, dnsQuery{Opcode: dnsOpcodeQuery, Name: d.netbiosInfo.ComputerName, Type: dnsTypeA, Class: dnsClassIN, EDNS: -1})
+	}
+
+	err := fmt.Errorf("no LLMNR query to send")
+	for _, q := range queries {
+		id := uint16(rand.Intn(0x10000))
+		var resp []byte
+		if resp, err = udpExchange(targetIP, 5355, q.marshal(id)); err != nil {
+			continue
+		}
+		var msg *dnsMessage
+		if msg, err = parseDNSMessage(resp, id); err != nil {
+			continue
+		}
+		info := &LLMNRInfo{Query: q.Name, Answers: len(msg.Answers)}
+		info.Hostname = strings.TrimSuffix(firstPTR(msg), ".")
+		if info.Hostname == "" && q.Type == dnsTypeA {
+			info.Hostname = q.Name
+		}
+		return info, nil
+	}
+	return nil, err
+}
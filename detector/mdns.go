@@ -0,0 +1,241 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// mdnsServiceEnumeration DNS-SD服务类型枚举名称
+const mdnsServiceEnumeration = "_services._dns-sd._udp.local"
+
+// mdnsInstanceServices 用于获取服务实例名称的服务类型，按优先级排列
+var mdnsInstanceServices = []string{
+	"_companion-link._tcp", "_airplay._tcp", "_smb._tcp", "_afpovertcp._tcp",
+	"_rfb._tcp", "_ipp._tcp", "_printer._tcp", "_workstation._tcp", "_http._tcp",
+}
+
+// mdnsPrinterServices 打印机发布的服务类型
+var mdnsPrinterServices = []string{"_ipp._tcp", "_ipps._tcp", "_printer._tcp", "_pdl-datastream._tcp", "_uscan._tcp"}
+
+// mdnsModelPrefixes _device-info中model字段前缀对应的系统
+var mdnsModelPrefixes = []struct {
+	prefix string
+	os     string
+}{
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"AppleTV", "iOS"},
+	{"AudioAccessory", "iOS"},
+	{"MacBook", "macOS"},
+	{"iMac", "macOS"},
+	{"Macmini", "macOS"},
+	{"MacPro", "macOS"},
+	{"RackMac", "macOS"},
+	{"Xserve", "macOS"},
+	{"Mac", "macOS"}, // Apple Silicon机型，例如 "Mac14,2"
+}
+
+// MDNSInfo mDNS/DNS-SD发现的主机信息
+type MDNSInfo struct {
+	Hostname  string
+	Services  []string
+	Instance  string
+	Model     string // _device-info中的model，例如 "MacBookPro18,1"
+	OSXVers   string // _device-info中的osxvers
+	HINFO     string // Avahi发布的HINFO记录，例如 "X86_64 LINUX"
+	IsPrinter bool
+}
+
+// MDNSFingerprint 通过单播mDNS查询主机名、服务类型和设备信息识别Apple设备、打印机和嵌入式Linux
+func (d *OSDetector) MDNSFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+	info := &MDNSInfo{}
+
+	// 反向解析得到 "xxx.local" 主机名
+	if reverse, err := mdnsReverseName(targetIP); err == nil {
+		if msg, err := mdnsQuery(targetIP, reverse, dnsTypePTR); err == nil {
+			info.Hostname = firstPTR(msg)
+		}
+	}
+	if msg, err := mdnsQuery(targetIP, mdnsServiceEnumeration, dnsTypePTR); err == nil {
+		for _, rr := range msg.Answers {
+			if name, err := rr.name(); err == nil && rr.Type == dnsTypePTR {
+				info.Services = append(info.Services, strings.TrimSuffix(name, ".local"))
+			}
+		}
+	}
+	if info.Hostname == "" && len(info.Services) == 0 {
+		if d.Verbose {
+			fmt.Println("[mDNS] No response")
+		}
+		return resultSet
+	}
+
+	// 从服务实例名称或主机名查询_device-info
+	for _, service := range mdnsInstanceServices {
+		if !info.hasService(service) {
+			continue
+		}
+		if msg, err := mdnsQuery(targetIP, service+".local", dnsTypePTR); err == nil {
+			if instance := firstPTR(msg); instance != "" {
+				info.Instance = strings.TrimSuffix(instance, "."+service+".local")
+				break
+			}
+		}
+	}
+	hostLabel := strings.Split(info.Hostname, ".")[0]
+	for _, name := range []string{info.Instance, hostLabel} {
+		if name == "" {
+			continue
+		}
+		if msg, err := mdnsQuery(targetIP, name+"._device-info._tcp.local", dnsTypeTXT); err == nil {
+			info.parseDeviceInfo(msg.txtStrings())
+			if info.Model != "" {
+				break
+			}
+		}
+	}
+	if info.Hostname != "" {
+		if msg, err := mdnsQuery(targetIP, info.Hostname, dnsTypeHINFO); err == nil {
+			info.HINFO = msg.hinfo()
+		}
+	}
+	for _, service := range mdnsPrinterServices {
+		if info.hasService(service) {
+			info.IsPrinter = true
+		}
+	}
+	d.mdnsInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[mDNS] Hostname: %s, Instance: %q, Model: %s, osxvers: %s, HINFO: %q, Printer: %v\n",
+			info.Hostname, info.Instance, info.Model, info.OSXVers, info.HINFO, info.IsPrinter)
+		fmt.Printf("[mDNS] Services: %s\n", strings.Join(info.Services, ", "))
+	}
+	d.addDetail("mDNS: %s, model %s, HINFO %q, %d services", info.Hostname, info.Model, info.HINFO, len(info.Services))
+	if info.IsPrinter {
+		log.Println("mDNS服务显示目标为打印机:", info.Instance)
+	}
+
+	switch {
+	case info.Model != "":
+		for _, m := range mdnsModelPrefixes {
+			if strings.HasPrefix(info.Model, m.prefix) {
+				resultSet[m.os] = true
+				break
+			}
+		}
+	case info.OSXVers != "":
+		resultSet["macOS"] = true
+	case containsIgnoreCase(info.HINFO, "linux"):
+		resultSet = newOSSet(LinuxFamily)
+		// 嵌入式设备上的Avahi通常没有发行版信息
+		d.osWeights["Linux"] += 2
+	case containsIgnoreCase(info.HINFO, "freebsd"):
+		resultSet["FreeBSD"] = true
+	case info.hasService("_apple-mobdev2._tcp"):
+		resultSet["iOS"] = true
+	case info.hasService("_companion-link._tcp"):
+		resultSet = newOSSet(AppleFamily)
+	case info.hasService("_workstation._tcp"):
+		// Avahi默认发布_workstation服务
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+	if len(resultSet) > 0 {
+		log.Println("mDNS信息显示目标系统为:", d.formatOSSet(resultSet))
+	}
+
+	return resultSet
+}
+
+// MDNSInfo 返回mDNS/DNS-SD信息，未探测或无响应时为nil
+func (d *OSDetector) MDNSInfo() *MDNSInfo {
+	return d.mdnsInfo
+}
+
+// mdnsQuery 向目标的5353端口发送单播查询，源端口不是5353时响应者会单播回复并回显ID
+func mdnsQuery(targetIP, name string, qtype uint16) (*dnsMessage, error) {
+	id := uint16(rand.Intn(0x10000))
+	q := dnsQuery{Opcode: dnsOpcodeQuery, Name: name, Type: qtype, Class: dnsClassIN, EDNS: -1}
+	resp, err := udpExchange(targetIP, 5353, q.marshal(id))
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSMessage(resp, id)
+}
+
+// mdnsReverseName 构造IPv4地址的反向解析名称
+func mdnsReverseName(targetIP string) (string, error) {
+	ip := net.ParseIP(targetIP).To4()
+	if ip == nil {
+		return "", fmt.Errorf("not an IPv4 address: %s", targetIP)
+	}
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip[3], ip[2], ip[1], ip[0]), nil
+}
+
+// firstPTR 返回应答段中第一条PTR记录指向的名称
+func firstPTR(msg *dnsMessage) string {
+	for _, rr := range msg.Answers {
+		if rr.Type != dnsTypePTR {
+			continue
+		}
+		if name, err := rr.name(); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// hinfo 返回应答段中第一条HINFO记录的CPU和OS字段
+func (m *dnsMessage) hinfo() string {
+	for _, rr := range m.Answers {
+		if rr.Type != dnsTypeHINFO {
+			continue
+		}
+		var fields []string
+		for i := 0; i < len(rr.Data); {
+			length := int(rr.Data[i])
+			i++
+			if i+length > len(rr.Data) {
+				break
+			}
+			fields = append(fields, string(rr.Data[i:i+length]))
+			i += length
+		}
+		return strings.Join(fields, " ")
+	}
+	return ""
+}
+
+// parseDeviceInfo 解析_device-info的TXT键值对
+func (info *MDNSInfo) parseDeviceInfo(txt []string) {
+	for _, kv := range txt {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "model":
+			info.Model = value
+		case "osxvers":
+			info.OSXVers = value
+		}
+	}
+}
+
+// hasService 检查是否发布了指定的服务类型
+func (info *MDNSInfo) hasService(service string) bool {
+	for _, s := range info.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
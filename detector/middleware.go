@@ -0,0 +1,210 @@
+package detector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MiddlewareHTTPPorts Java中间件常用的HTTP端口
+var MiddlewareHTTPPorts = []int{7001, 8080}
+
+// middlewarePaths 可能泄露版本或JVM系统属性的页面
+var middlewarePaths = []string{
+	"/console/login/LoginForm.jsp",
+	"/actuator/env",
+	"/env",
+	"/",
+}
+
+// middlewareProducts 从响应头和页面中识别中间件产品及版本
+var middlewareProducts = []struct {
+	product string
+	pattern *regexp.Regexp
+}{
+	{"WebLogic", regexp.MustCompile(`WebLogic Server(?: Version:?)? ?([\d.]+)`)},
+	{"WebSphere", regexp.MustCompile(`WebSphere Application Server/?([\d.]+)?`)},
+	{"JBoss", regexp.MustCompile(`JBoss(?:[- ]?(?:AS|EAP|Web))?[/ -]?([\d.]+(?:\.GA|\.Final)?)?`)},
+	{"WildFly", regexp.MustCompile(`WildFly[/ ]?([\d.]+(?:\.Final)?)?`)},
+	{"GlassFish", regexp.MustCompile(`GlassFish Server Open Source Edition\s+([\d.]+)`)},
+	{"Tomcat", regexp.MustCompile(`Apache Tomcat/([\d.]+)`)},
+	{"Jetty", regexp.MustCompile(`Jetty\(([\w.\-]+)\)`)},
+}
+
+var (
+	// t3HelloPattern T3握手响应，例如 "HELO:12.2.1.3.0.false"
+	t3HelloPattern = regexp.MustCompile(`HELO:([\d.]+)\.(?:true|false)`)
+	// JVM系统属性可能以JSON、properties或HTML表格的形式出现
+	javaOSNamePattern    = regexp.MustCompile(`os\.name["']?\s*(?:[:=]|</t[dh]>\s*<td[^>]*>)\s*(?:\{\s*"value"\s*:\s*)?["']?([A-Za-z][\w ./]*?)["'<\r\n,}]`)
+	javaOSVersionPattern = regexp.MustCompile(`os\.version["']?\s*(?:[:=]|</t[dh]>\s*<td[^>]*>)\s*(?:\{\s*"value"\s*:\s*)?["']?([\w.\-+]+)`)
+)
+
+// MiddlewareInfo Java中间件版本和JVM泄露的系统信息
+type MiddlewareInfo struct {
+	Product   string
+	Version   string
+	T3Version string // WebLogic T3握手返回的版本
+	OSName    string // JVM的os.name属性
+	OSVersion string // JVM的os.version属性
+	Source    string // 泄露系统属性的URL
+}
+
+// MiddlewareFingerprint 通过WebLogic T3握手和HTTP页面识别Java中间件及JVM泄露的操作系统
+func (d *OSDetector) MiddlewareFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+	info := &MiddlewareInfo{}
+
+	if version, err := t3Handshake(targetIP); err == nil {
+		info.Product = "WebLogic"
+		info.T3Version = version
+		info.Version = version
+	} else if d.Verbose {
+		fmt.Printf("[Middleware] T3 handshake failed: %v\n", err)
+	}
+
+	client := &http.Client{
+		Timeout: time.Duration(MaxRTT*(ResendCount+1)) * time.Second,
+		// 不跟随重定向，登录页面的跳转目标通常不包含版本信息
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	for _, port := range MiddlewareHTTPPorts {
+		for _, path := range middlewarePaths {
+			url := "http://" + net.JoinHostPort(targetIP, strconv.Itoa(port)) + path
+			page, err := fetchMiddlewarePage(client, url)
+			if err != nil {
+				if d.Verbose {
+					fmt.Printf("[Middleware] %s: %v\n", url, err)
+				}
+				// 连接失败时跳过该端口的其他路径
+				break
+			}
+			info.parsePage(page, url)
+		}
+	}
+
+	if info.Product == "" && info.OSName == "" {
+		return resultSet
+	}
+	d.middlewareInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[Middleware] Product: %s %s, T3: %s, os.name: %q, os.version: %q (%s)\n",
+			info.Product, info.Version, info.T3Version, info.OSName, info.OSVersion, info.Source)
+	}
+	d.addDetail("Middleware: %s %s, JVM os.name %q os.version %q", info.Product, info.Version, info.OSName, info.OSVersion)
+
+	resultSet = osSetFromJavaProperties(info.OSName, info.OSVersion)
+	for os := range resultSet {
+		d.osWeights[os] += 3
+	}
+	if len(resultSet) > 0 {
+		log.Printf("JVM系统属性泄露了操作系统: %s %s (%s)\n", info.OSName, info.OSVersion, info.Source)
+	}
+
+	return resultSet
+}
+
+// MiddlewareInfo 返回Java中间件信息，未探测或无响应时为nil
+func (d *OSDetector) MiddlewareInfo() *MiddlewareInfo {
+	return d.middlewareInfo
+}
+
+// t3Handshake 发送WebLogic T3协议握手并返回服务器版本
+func t3Handshake(targetIP string) (string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "7001"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	if _, err := conn.Write([]byte("t3 12.2.1\nAS:255\nHL:19\nMS:10000000\n\n")); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if line == "" {
+		return "", err
+	}
+	m := t3HelloPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", fmt.Errorf("unexpected T3 response %q", strings.TrimSpace(line))
+	}
+	return m[1], nil
+}
+
+// fetchMiddlewarePage 获取页面，返回响应头和正文拼接的文本
+func fetchMiddlewarePage(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	for _, key := range []string{"Server", "X-Powered-By"} {
+		for _, value := range resp.Header.Values(key) {
+			fmt.Fprintf(&text, "%s: %s\n", key, value)
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	text.Write(body)
+	return text.String(), nil
+}
+
+// parsePage 从页面中提取中间件版本和JVM系统属性，只保留首次发现的值
+func (info *MiddlewareInfo) parsePage(page, url string) {
+	if info.Product == "" || info.Version == "" {
+		for _, p := range middlewareProducts {
+			if m := p.pattern.FindStringSubmatch(page); m != nil {
+				if info.Product == "" || info.Product == p.product {
+					info.Product = p.product
+					info.Version = m[1]
+				}
+				break
+			}
+		}
+	}
+
+	if info.OSName == "" {
+		if m := javaOSNamePattern.FindStringSubmatch(page); m != nil {
+			info.OSName = strings.TrimSpace(m[1])
+			info.Source = url
+			if m := javaOSVersionPattern.FindStringSubmatch(page); m != nil {
+				info.OSVersion = m[1]
+			}
+		}
+	}
+}
+
+// osSetFromJavaProperties 根据JVM的os.name和os.version推断操作系统
+// 例如 "Linux" + "5.15.0-91-generic"、"Windows Server 2019" + "10.0"、"FreeBSD" + "13.2-RELEASE"
+func osSetFromJavaProperties(name, version string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	switch {
+	case strings.HasPrefix(name, "Linux"):
+		resultSet = osSetFromLinuxKernel(version)
+	case strings.HasPrefix(name, "FreeBSD"):
+		resultSet["FreeBSD"] = true
+	case strings.HasPrefix(name, "Windows"):
+		// os.name已经包含具体版本，R2与基础版本合并
+		base := strings.TrimSuffix(strings.TrimSuffix(name, " R2"), ".1")
+		for _, os := range WindowsFamily {
+			if os == base {
+				resultSet[os] = true
+			}
+		}
+		if len(resultSet) == 0 {
+			resultSet = newOSSet(WindowsFamily)
+		}
+	}
+
+	return resultSet
+}
@@ -0,0 +1,458 @@
+package detector
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// DCE/RPC 报文类型
+const (
+	rpcPtypeRequest  = 0
+	rpcPtypeResponse = 2
+	rpcPtypeFault    = 3
+	rpcPtypeBind     = 11
+	rpcPtypeBindAck  = 12
+
+	rpcPfcFirstFrag = 0x01
+	rpcPfcLastFrag  = 0x02
+
+	rpcMaxFrag = 4280
+)
+
+// DCE/RPC 上下文协商结果
+const (
+	rpcResultAcceptance   = 0
+	rpcResultNegotiateAck = 3
+)
+
+// 端点映射器及传输语法的接口标识
+const (
+	rpcUUIDEPM   = "e1af8308-5d1f-11c9-91a4-08002b14a0fa"
+	rpcUUIDNDR   = "8a885d04-1ceb-11c9-9fe8-08002b104860"
+	rpcUUIDNDR64 = "71710533-beba-4937-8319-b5dbef9ccc36"
+	rpcUUIDBTFN  = "6cb71c2c-9812-4540-0300-000000000000" // Bind Time Feature Negotiation
+
+	rpcOpEptLookup = 2
+	rpcEptMaxEnts  = 100
+	rpcEptMaxCalls = 10
+)
+
+// rpcServerInterfaces 只在Windows Server角色上注册的RPC接口
+var rpcServerInterfaces = map[string]string{
+	"e3514235-4b06-11d1-ab04-00c04fc2dcd2": "DRSUAPI",
+	"12345678-1234-abcd-ef00-01234567cffb": "NETLOGON",
+	"50abc2a4-574d-40b3-9d66-ee4fd5fba076": "DNS Server",
+	"6bffd098-a112-3610-9833-46c3f874532d": "DHCP Server",
+	"897e2e5f-93f3-4376-9c9c-fd2277495c27": "DFS Replication",
+	"f5cc59b4-4264-101a-8c59-08002b2f8426": "File Replication",
+	"91ae6020-9e3c-11cf-8d7c-00aa00c091be": "Certificate Services",
+	"4fc742e0-4a10-11cf-8273-00aa004ae673": "DFS",
+}
+
+// RPCInterface 端点映射器中注册的接口
+type RPCInterface struct {
+	UUID       string
+	Version    string
+	Protocol   string // ncacn_ip_tcp、ncacn_np、ncalrpc等
+	Annotation string
+}
+
+// MSRPCInfo 端点映射器指纹信息
+type MSRPCInfo struct {
+	SecondaryAddr string // bind_ack中的次要地址
+	NDR64         bool   // 是否接受NDR64传输语法
+	BindTimeNeg   bool   // 是否响应Bind Time Feature Negotiation
+	Interfaces    []RPCInterface
+	ServerRoles   []string // 识别出的Windows Server角色接口
+	IsSamba       bool
+}
+
+// MSRPCFingerprint 通过RPC端点映射器识别Windows桌面版、服务器版和Samba
+func (d *OSDetector) MSRPCFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "135"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MSRPC] Failed to connect: %v\n", err)
+		}
+		return resultSet
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	info, err := rpcBindEPM(conn)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[MSRPC] Bind failed: %v\n", err)
+		}
+		return resultSet
+	}
+	info.Interfaces = rpcEptLookupAll(conn)
+
+	seen := make(map[string]bool)
+	for _, iface := range info.Interfaces {
+		if role, ok := rpcServerInterfaces[iface.UUID]; ok && !seen[role] {
+			seen[role] = true
+			info.ServerRoles = append(info.ServerRoles, role)
+		}
+		if containsIgnoreCase(iface.Annotation, "samba") {
+			info.IsSamba = true
+		}
+	}
+	// NetBIOS节点状态中的全零MAC是Samba nmbd的明确特征
+	if d.netbiosInfo != nil && d.netbiosInfo.IsSamba {
+		info.IsSamba = true
+	}
+	// Samba不支持NDR64，且注册的接口很少、没有注释；32位或受防火墙限制的Windows也可能如此，只作为权重
+	sambaLike := !info.NDR64 && !info.BindTimeNeg && len(info.Interfaces) > 0 && len(info.Interfaces) < 30 && !rpcHasAnnotations(info.Interfaces)
+	d.msrpcInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[MSRPC] SecondaryAddr: %q, NDR64: %v, BTFN: %v, Interfaces: %d, Server roles: %v, Samba: %v\n",
+			info.SecondaryAddr, info.NDR64, info.BindTimeNeg, len(info.Interfaces), info.ServerRoles, info.IsSamba)
+		for _, iface := range info.Interfaces {
+			fmt.Printf("[MSRPC]   %s v%s %s %q\n", iface.UUID, iface.Version, iface.Protocol, iface.Annotation)
+		}
+	}
+	d.addDetail("MSRPC: %d interfaces, NDR64=%v, roles %v", len(info.Interfaces), info.NDR64, info.ServerRoles)
+
+	switch {
+	case info.IsSamba:
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		log.Println("RPC端点映射器具有Samba特征")
+	case len(info.ServerRoles) > 0:
+		resultSet = newOSSet(WindowsServerFamily)
+		log.Println("RPC端点映射器中注册了服务器角色接口:", strings.Join(info.ServerRoles, ", "))
+	case sambaLike:
+		for _, os := range append([]string{"FreeBSD"}, LinuxFamily...) {
+			d.osWeights[os] += 2
+		}
+		log.Println("RPC端点映射器不支持NDR64且接口较少，可能是Samba")
+		return resultSet
+	default:
+		resultSet = newOSSet(WindowsFamily)
+		for _, os := range WindowsClientFamily {
+			d.osWeights[os]++
+		}
+	}
+
+	// NDR64只在64位的Vista/Server 2008及之后版本上可用，BTFN从Windows 7/Server 2008 R2开始支持
+	if info.NDR64 || info.BindTimeNeg {
+		delete(resultSet, "Windows XP")
+		delete(resultSet, "Windows Server 2003")
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 2
+	}
+
+	return resultSet
+}
+
+// MSRPCInfo 返回RPC端点映射器信息，未探测或无响应时为nil
+func (d *OSDetector) MSRPCInfo() *MSRPCInfo {
+	return d.msrpcInfo
+}
+
+// rpcBindEPM 绑定端点映射器，同时提供NDR、NDR64和BTFN三种传输语法
+func rpcBindEPM(conn net.Conn) (*MSRPCInfo, error) {
+	transfers := []struct {
+		uuid    string
+		version uint32
+	}{
+		{rpcUUIDNDR, 2},
+		{rpcUUIDNDR64, 1},
+		{rpcUUIDBTFN, 1},
+	}
+
+	body := binary.LittleEndian.AppendUint16(nil, rpcMaxFrag) // max_xmit_frag
+	body = binary.LittleEndian.AppendUint16(body, rpcMaxFrag) // max_recv_frag
+	body = binary.LittleEndian.AppendUint32(body, 0)          // assoc_group_id
+	body = append(body, byte(len(transfers)), 0, 0, 0)
+	for i, transfer := range transfers {
+		body = binary.LittleEndian.AppendUint16(body, uint16(i)) // p_cont_id
+		body = append(body, 1, 0)                                // n_transfer_syn
+		body = append(body, rpcUUIDBytes(rpcUUIDEPM)...)
+		body = binary.LittleEndian.AppendUint32(body, 3) // EPM v3.0
+		body = append(body, rpcUUIDBytes(transfer.uuid)...)
+		body = binary.LittleEndian.AppendUint32(body, transfer.version)
+	}
+
+	if _, err := conn.Write(rpcPDU(rpcPtypeBind, 1, body)); err != nil {
+		return nil, err
+	}
+	ptype, pdu, err := rpcReadPDU(conn)
+	if err != nil {
+		return nil, err
+	}
+	if ptype != rpcPtypeBindAck {
+		return nil, fmt.Errorf("bind rejected (ptype %d)", ptype)
+	}
+
+	// bind_ack: max_xmit(2) max_recv(2) assoc_group(4) sec_addr_len(2) sec_addr 对齐到4字节
+	if len(pdu) < 26 {
+		return nil, fmt.Errorf("bind_ack too short")
+	}
+	info := &MSRPCInfo{}
+	secLen := int(binary.LittleEndian.Uint16(pdu[24:26]))
+	off := 26 + secLen
+	if off > len(pdu) {
+		return nil, fmt.Errorf("invalid secondary address")
+	}
+	info.SecondaryAddr = strings.TrimRight(string(pdu[26:off]), "\x00")
+	off = (off + 3) &^ 3
+
+	if off+4 > len(pdu) {
+		return nil, fmt.Errorf("bind_ack without results")
+	}
+	numResults := int(pdu[off])
+	off += 4
+	for i := 0; i < numResults && off+24 <= len(pdu); i++ {
+		result := binary.LittleEndian.Uint16(pdu[off:])
+		switch {
+		case i == 0 && result != rpcResultAcceptance:
+			return nil, fmt.Errorf("NDR transfer syntax rejected")
+		case i == 1 && result == rpcResultAcceptance:
+			info.NDR64 = true
+		case i == 2 && result == rpcResultNegotiateAck:
+			info.BindTimeNeg = true
+		}
+		off += 24
+	}
+
+	return info, nil
+}
+
+// rpcEptLookupAll 反复调用ept_lookup枚举所有注册的接口
+func rpcEptLookupAll(conn net.Conn) []RPCInterface {
+	var interfaces []RPCInterface
+	handle := make([]byte, 20)
+
+	for call := 0; call < rpcEptMaxCalls; call++ {
+		stub := binary.LittleEndian.AppendUint32(nil, 0) // inquiry_type = RPC_C_EP_ALL_ELTS
+		stub = binary.LittleEndian.AppendUint32(stub, 0) // object = NULL
+		stub = binary.LittleEndian.AppendUint32(stub, 0) // interface_id = NULL
+		stub = binary.LittleEndian.AppendUint32(stub, 1) // vers_option = RPC_C_VERS_ALL
+		stub = append(stub, handle...)
+		stub = binary.LittleEndian.AppendUint32(stub, rpcEptMaxEnts)
+
+		body := binary.LittleEndian.AppendUint32(nil, uint32(len(stub))) // alloc_hint
+		body = binary.LittleEndian.AppendUint16(body, 0)                 // p_cont_id
+		body = binary.LittleEndian.AppendUint16(body, rpcOpEptLookup)
+		body = append(body, stub...)
+		if _, err := conn.Write(rpcPDU(rpcPtypeRequest, uint32(call+2), body)); err != nil {
+			break
+		}
+
+		response, err := rpcReadResponse(conn)
+		if err != nil {
+			break
+		}
+		entries, next, status := parseEptLookupResponse(response)
+		interfaces = append(interfaces, entries...)
+
+		// 状态非0（EPT_S_NOT_REGISTERED）或句柄为空表示枚举结束
+		if status != 0 || len(entries) == 0 || isZero(next) {
+			break
+		}
+		handle = next
+	}
+
+	return interfaces
+}
+
+// parseEptLookupResponse 解析ept_lookup响应中的条目、上下文句柄和状态
+func parseEptLookupResponse(stub []byte) ([]RPCInterface, []byte, uint32) {
+	if len(stub) < 36 {
+		return nil, nil, 1
+	}
+	handle := stub[0:20]
+	numEnts := int(binary.LittleEndian.Uint32(stub[20:24]))
+	status := binary.LittleEndian.Uint32(stub[len(stub)-4:])
+
+	// 条目数组: max_count(4) offset(4) actual_count(4)
+	off := 36
+	entries := make([]RPCInterface, 0, numEnts)
+	towerRefs := make([]uint32, 0, numEnts)
+	for i := 0; i < numEnts; i++ {
+		// object(16) tower指针(4) annotation: offset(4) actual_count(4) 字符串
+		if off+28 > len(stub) {
+			return entries, handle, status
+		}
+		towerRefs = append(towerRefs, binary.LittleEndian.Uint32(stub[off+16:]))
+		annLen := int(binary.LittleEndian.Uint32(stub[off+24:]))
+		off += 28
+		if off+annLen > len(stub) {
+			return entries, handle, status
+		}
+		entries = append(entries, RPCInterface{Annotation: strings.TrimRight(string(stub[off:off+annLen]), "\x00")})
+		off = (off + annLen + 3) &^ 3
+	}
+
+	// 延迟写入的tower: max_count(4) tower_length(4) tower
+	for i := range entries {
+		if towerRefs[i] == 0 {
+			continue
+		}
+		if off+8 > len(stub) {
+			break
+		}
+		towerLen := int(binary.LittleEndian.Uint32(stub[off+4:]))
+		off += 8
+		if off+towerLen > len(stub) {
+			break
+		}
+		entries[i].UUID, entries[i].Version, entries[i].Protocol = parseRPCTower(stub[off : off+towerLen])
+		off = (off + towerLen + 3) &^ 3
+	}
+
+	return entries, handle, status
+}
+
+// parseRPCTower 解析协议塔，返回接口UUID、版本和传输协议
+func parseRPCTower(tower []byte) (string, string, string) {
+	if len(tower) < 2 {
+		return "", "", ""
+	}
+	floors := int(binary.LittleEndian.Uint16(tower))
+	off := 2
+
+	var uuid, version, protocol string
+	for i := 0; i < floors; i++ {
+		if off+2 > len(tower) {
+			break
+		}
+		lhsLen := int(binary.LittleEndian.Uint16(tower[off:]))
+		off += 2
+		if off+lhsLen+2 > len(tower) || lhsLen == 0 {
+			break
+		}
+		lhs := tower[off : off+lhsLen]
+		off += lhsLen
+		rhsLen := int(binary.LittleEndian.Uint16(tower[off:]))
+		off += 2 + rhsLen
+
+		switch {
+		case i == 0 && lhs[0] == 0x0d && len(lhs) >= 19:
+			uuid = rpcFormatUUID(lhs[1:17])
+			version = fmt.Sprintf("%d.0", binary.LittleEndian.Uint16(lhs[17:19]))
+		case i == 3:
+			switch lhs[0] {
+			case 0x07:
+				protocol = "ncacn_ip_tcp"
+			case 0x08:
+				protocol = "ncadg_ip_udp"
+			case 0x0f:
+				protocol = "ncacn_np"
+			case 0x10:
+				protocol = "ncalrpc"
+			case 0x1f:
+				protocol = "ncacn_http"
+			}
+		}
+	}
+
+	return uuid, version, protocol
+}
+
+// rpcPDU 构造一个单分片的DCE/RPC报文
+func rpcPDU(ptype byte, callID uint32, body []byte) []byte {
+	pdu := []byte{5, 0, ptype, rpcPfcFirstFrag | rpcPfcLastFrag, 0x10, 0, 0, 0} // 小端数据表示
+	pdu = binary.LittleEndian.AppendUint16(pdu, uint16(16+len(body)))
+	pdu = binary.LittleEndian.AppendUint16(pdu, 0) // auth_length
+	pdu = binary.LittleEndian.AppendUint32(pdu, callID)
+	return append(pdu, body...)
+}
+
+// rpcReadPDU 读取一个DCE/RPC分片，返回报文类型和完整报文
+func rpcReadPDU(conn net.Conn) (byte, []byte, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, nil, err
+	}
+	if header[0] != 5 {
+		return 0, nil, fmt.Errorf("not a DCE/RPC PDU")
+	}
+	fragLen := int(binary.LittleEndian.Uint16(header[8:10]))
+	if fragLen < 16 {
+		return 0, nil, fmt.Errorf("invalid fragment length %d", fragLen)
+	}
+
+	pdu := make([]byte, fragLen)
+	copy(pdu, header)
+	if _, err := io.ReadFull(conn, pdu[16:]); err != nil {
+		return 0, nil, err
+	}
+	return header[2], pdu, nil
+}
+
+// rpcReadResponse 读取响应的所有分片并拼接存根数据
+func rpcReadResponse(conn net.Conn) ([]byte, error) {
+	var stub []byte
+	for {
+		ptype, pdu, err := rpcReadPDU(conn)
+		if err != nil {
+			return nil, err
+		}
+		if ptype == rpcPtypeFault {
+			return nil, fmt.Errorf("RPC fault")
+		}
+		// 响应头部之后是 alloc_hint(4) p_cont_id(2) cancel_count(1) reserved(1)
+		if ptype != rpcPtypeResponse || len(pdu) < 24 {
+			return nil, fmt.Errorf("unexpected PDU type %d", ptype)
+		}
+		stub = append(stub, pdu[24:]...)
+		if pdu[3]&rpcPfcLastFrag != 0 {
+			return stub, nil
+		}
+	}
+}
+
+// rpcUUIDBytes 将UUID字符串转换为DCE/RPC使用的混合字节序表示
+func rpcUUIDBytes(uuid string) []byte {
+	raw, _ := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if len(raw) != 16 {
+		return make([]byte, 16)
+	}
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint32(b[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(b[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(b[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(b[8:], raw[8:])
+	return b
+}
+
+// rpcFormatUUID 将混合字节序的UUID格式化为字符串
+func rpcFormatUUID(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:]),
+		binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]),
+		b[8:10], b[10:16])
+}
+
+// rpcHasAnnotations 检查接口是否带有注释，Windows的大部分端点都带有描述性注释
+func rpcHasAnnotations(interfaces []RPCInterface) bool {
+	for _, iface := range interfaces {
+		if iface.Annotation != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isZero 检查字节切片是否全为0
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
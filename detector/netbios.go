@@ -0,0 +1,204 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// NetBIOS 名称服务相关常量
+const (
+	nbnsTypeNBSTAT = 0x0021
+	nbnsClassIN    = 0x0001
+	nbnsGroupFlag  = 0x8000
+)
+
+// NetBIOS 名称后缀
+const (
+	nbSuffixWorkstation = 0x00
+	nbSuffixMessenger   = 0x03
+	nbSuffixDomainCtrl  = 0x1c
+)
+
+// NetBIOSName NBSTAT响应中的一条名称记录
+type NetBIOSName struct {
+	Name   string
+	Suffix byte
+	Group  bool
+}
+
+// NetBIOSInfo NetBIOS节点状态信息
+type NetBIOSInfo struct {
+	Names        []NetBIOSName
+	ComputerName string
+	Workgroup    string
+	MAC          string
+	IsSamba      bool // Samba的nmbd在节点状态响应中返回全零MAC地址
+}
+
+// String 以 NAME<XX> 的形式输出名称
+func (n NetBIOSName) String() string {
+	if n.Group {
+		return fmt.Sprintf("%s<%02X> (group)", n.Name, n.Suffix)
+	}
+	return fmt.Sprintf("%s<%02X>", n.Name, n.Suffix)
+}
+
+// NetBIOSFingerprint 通过NetBIOS节点状态查询识别Windows和Samba主机
+func (d *OSDetector) NetBIOSFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	id := uint16(rand.Intn(0x10000))
+	response, err := udpExchange(targetIP, 137, nbstatRequest(id))
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[NetBIOS] No response: %v\n", err)
+		}
+		return resultSet
+	}
+
+	info, err := parseNBSTATResponse(response, id)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[NetBIOS] Invalid response: %v\n", err)
+		}
+		return resultSet
+	}
+	d.netbiosInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[NetBIOS] Computer: %s, Workgroup: %s, MAC: %s, Samba: %v\n", info.ComputerName, info.Workgroup, info.MAC, info.IsSamba)
+		for _, name := range info.Names {
+			fmt.Printf("[NetBIOS]   %s\n", name)
+		}
+	}
+	d.addDetail("NetBIOS: %s\\%s, MAC %s", info.Workgroup, info.ComputerName, info.MAC)
+
+	if info.IsSamba {
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		for os := range resultSet {
+			d.osWeights[os] += 2
+		}
+		log.Println("NetBIOS节点状态返回全零MAC地址，可能是Samba主机")
+		return resultSet
+	}
+
+	resultSet = newOSSet(WindowsFamily)
+	for os := range resultSet {
+		d.osWeights[os] += 2
+	}
+	// Messenger服务（<03>）在Windows Vista之后已被移除
+	if info.hasSuffix(nbSuffixMessenger, false) {
+		d.osWeights["Windows XP"] += 2
+	}
+	if info.hasSuffix(nbSuffixDomainCtrl, true) {
+		log.Println("NetBIOS名称包含<1C>组，目标可能是域控制器")
+	}
+	log.Println("目标响应NetBIOS节点状态查询，可能是Windows系统")
+
+	return resultSet
+}
+
+// NetBIOSInfo 返回NetBIOS节点状态信息（名称、工作组和MAC地址），未探测或无响应时为nil
+func (d *OSDetector) NetBIOSInfo() *NetBIOSInfo {
+	return d.netbiosInfo
+}
+
+// nbstatRequest 构造通配名称 "*" 的NBSTAT查询
+func nbstatRequest(id uint16) []byte {
+	request := make([]byte, 12, 50)
+	binary.BigEndian.PutUint16(request[0:2], id)
+	binary.BigEndian.PutUint16(request[4:6], 1) // QDCOUNT=1
+
+	request = append(request, encodeNetBIOSName("*", 0x00)...)
+	request = binary.BigEndian.AppendUint16(request, nbnsTypeNBSTAT)
+	request = binary.BigEndian.AppendUint16(request, nbnsClassIN)
+	return request
+}
+
+// encodeNetBIOSName 按RFC 1002进行一级编码
+func encodeNetBIOSName(name string, suffix byte) []byte {
+	raw := make([]byte, 16)
+	copy(raw, name)
+	// 通配名称用NUL填充，其他名称用空格填充
+	if name != "*" {
+		for i := len(name); i < 15; i++ {
+			raw[i] = ' '
+		}
+	}
+	raw[15] = suffix
+
+	encoded := []byte{0x20}
+	for _, b := range raw {
+		encoded = append(encoded, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	return append(encoded, 0)
+}
+
+// parseNBSTATResponse 解析NBSTAT响应中的名称表和MAC地址
+func parseNBSTATResponse(data []byte, id uint16) (*NetBIOSInfo, error) {
+	if len(data) < 12 || binary.BigEndian.Uint16(data[0:2]) != id {
+		return nil, fmt.Errorf("unexpected NBNS response")
+	}
+	if binary.BigEndian.Uint16(data[6:8]) == 0 {
+		return nil, fmt.Errorf("no answer in NBNS response")
+	}
+
+	off, err := skipDNSName(data, 12)
+	if err != nil {
+		return nil, err
+	}
+	if off+10 > len(data) || binary.BigEndian.Uint16(data[off:]) != nbnsTypeNBSTAT {
+		return nil, fmt.Errorf("not an NBSTAT answer")
+	}
+	off += 10 // TYPE、CLASS、TTL、RDLENGTH
+
+	if off >= len(data) {
+		return nil, fmt.Errorf("truncated NBSTAT answer")
+	}
+	count := int(data[off])
+	off++
+
+	info := &NetBIOSInfo{}
+	for i := 0; i < count; i++ {
+		if off+18 > len(data) {
+			return nil, fmt.Errorf("truncated NetBIOS name table")
+		}
+		name := NetBIOSName{
+			Name:   strings.TrimRight(string(data[off:off+15]), " \x00"),
+			Suffix: data[off+15],
+			Group:  binary.BigEndian.Uint16(data[off+16:])&nbnsGroupFlag != 0,
+		}
+		info.Names = append(info.Names, name)
+		off += 18
+
+		switch {
+		case !name.Group && name.Suffix == nbSuffixWorkstation && info.ComputerName == "":
+			info.ComputerName = name.Name
+		case name.Group && name.Suffix == nbSuffixWorkstation && info.Workgroup == "":
+			info.Workgroup = name.Name
+		}
+	}
+
+	// 名称表之后是6字节的Unit ID（MAC地址）
+	if off+6 <= len(data) {
+		mac := net.HardwareAddr(data[off : off+6])
+		info.MAC = mac.String()
+		info.IsSamba = mac.String() == "00:00:00:00:00:00"
+	}
+
+	return info, nil
+}
+
+// hasSuffix 检查名称表中是否存在指定后缀的名称
+func (info *NetBIOSInfo) hasSuffix(suffix byte, group bool) bool {
+	for _, name := range info.Names {
+		if name.Suffix == suffix && name.Group == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package detector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLMSSP 消息标识
+var NTLMSSP_SIGNATURE = []byte("NTLMSSP\x00")
+
+// NTLMSSP 消息类型
+const (
+	NTLMSSP_NEGOTIATE = 1
+	NTLMSSP_CHALLENGE = 2
+	NTLMSSP_AUTH      = 3
+)
+
+// NTLMSSP 协商标志
+const (
+	ntlmNegotiateUnicode          = 0x00000001
+	ntlmRequestTarget             = 0x00000004
+	ntlmNegotiateNTLM             = 0x00000200
+	ntlmNegotiateAlwaysSign       = 0x00008000
+	ntlmNegotiateExtendedSecurity = 0x00080000
+	ntlmNegotiateTargetInfo       = 0x00800000
+	ntlmNegotiateVersion          = 0x02000000
+	ntlmNegotiate128              = 0x20000000
+	ntlmNegotiate56               = 0x80000000
+)
+
+// NTLMSSP AV_PAIR 类型
+const (
+	ntlmAvEOL             = 0
+	ntlmAvNbComputerName  = 1
+	ntlmAvNbDomainName    = 2
+	ntlmAvDNSComputerName = 3
+	ntlmAvDNSDomainName   = 4
+	ntlmAvDNSTreeName     = 5
+	ntlmAvTimestamp       = 7
+)
+
+// NTLMSSP Version 结构
+type NTLMSSPVersion struct {
+	ProductMajorVersion uint8
+	ProductMinorVersion uint8
+	ProductBuild        uint16
+	Reserved            [3]byte
+	NTLMRevisionCurrent uint8
+}
+
+// NTLMChallengeInfo NTLMSSP Challenge消息中泄露的版本和名称信息
+type NTLMChallengeInfo struct {
+	Version         *NTLMSSPVersion
+	NetBIOSComputer string
+	NetBIOSDomain   string
+	DNSComputer     string
+	DNSDomain       string
+	DNSTree         string
+	Timestamp       time.Time // 服务器当前时间
+}
+
+// ntlmNegotiateMessage 构造请求版本信息和目标信息的NTLMSSP Negotiate消息
+func ntlmNegotiateMessage() []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSecurity | ntlmNegotiateTargetInfo | ntlmNegotiateVersion | ntlmNegotiate128 | ntlmNegotiate56)
+
+	msg := make([]byte, 0, 40)
+	msg = append(msg, NTLMSSP_SIGNATURE...)
+	msg = binary.LittleEndian.AppendUint32(msg, NTLMSSP_NEGOTIATE)
+	msg = binary.LittleEndian.AppendUint32(msg, flags)
+	// DomainNameFields 和 WorkstationFields 均为空
+	for i := 0; i < 2; i++ {
+		msg = binary.LittleEndian.AppendUint16(msg, 0)
+		msg = binary.LittleEndian.AppendUint16(msg, 0)
+		msg = binary.LittleEndian.AppendUint32(msg, 40)
+	}
+	// 客户端版本 6.1.7601，NTLM修订版本15
+	msg = append(msg, 6, 1)
+	msg = binary.LittleEndian.AppendUint16(msg, 7601)
+	msg = append(msg, 0, 0, 0, 15)
+	return msg
+}
+
+// parseNTLMChallenge 解析NTLMSSP Challenge消息中的版本信息和目标信息
+func parseNTLMChallenge(data []byte) (*NTLMChallengeInfo, error) {
+	// 查找NTLMSSP签名
+	idx := bytes.Index(data, NTLMSSP_SIGNATURE)
+	if idx == -1 {
+		return nil, fmt.Errorf("NTLMSSP signature not found")
+	}
+	msg := data[idx:]
+	if len(msg) < 48 {
+		return nil, fmt.Errorf("data too short")
+	}
+
+	// 确认是Challenge消息
+	if binary.LittleEndian.Uint32(msg[8:]) != NTLMSSP_CHALLENGE {
+		return nil, fmt.Errorf("not a challenge message")
+	}
+	flags := binary.LittleEndian.Uint32(msg[20:])
+
+	info := &NTLMChallengeInfo{}
+
+	// 版本信息紧随TargetInfoFields之后，偏移量为48
+	if flags&ntlmNegotiateVersion != 0 && len(msg) >= 56 {
+		version := &NTLMSSPVersion{
+			ProductMajorVersion: msg[48],
+			ProductMinorVersion: msg[49],
+			ProductBuild:        binary.LittleEndian.Uint16(msg[50:]),
+			NTLMRevisionCurrent: msg[55],
+		}
+		copy(version.Reserved[:], msg[52:55])
+		info.Version = version
+	}
+
+	// 解析TargetInfo中的AV_PAIR
+	infoLen := int(binary.LittleEndian.Uint16(msg[40:]))
+	infoOffset := int(binary.LittleEndian.Uint32(msg[44:]))
+	if infoLen == 0 || infoOffset+infoLen > len(msg) {
+		return info, nil
+	}
+	avPairs := msg[infoOffset : infoOffset+infoLen]
+	for off := 0; off+4 <= len(avPairs); {
+		avID := binary.LittleEndian.Uint16(avPairs[off:])
+		avLen := int(binary.LittleEndian.Uint16(avPairs[off+2:]))
+		off += 4
+		if avID == ntlmAvEOL || off+avLen > len(avPairs) {
+			break
+		}
+		value := avPairs[off : off+avLen]
+		off += avLen
+
+		switch avID {
+		case ntlmAvNbComputerName:
+			info.NetBIOSComputer = decodeUTF16LE(value)
+		case ntlmAvNbDomainName:
+			info.NetBIOSDomain = decodeUTF16LE(value)
+		case ntlmAvDNSComputerName:
+			info.DNSComputer = decodeUTF16LE(value)
+		case ntlmAvDNSDomainName:
+			info.DNSDomain = decodeUTF16LE(value)
+		case ntlmAvDNSTreeName:
+			info.DNSTree = decodeUTF16LE(value)
+		case ntlmAvTimestamp:
+			if avLen == 8 {
+				info.Timestamp = fileTimeToTime(binary.LittleEndian.Uint64(value))
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// osSetFromNTLMChallenge 根据NTLMSSP版本信息确定Windows版本并记录名称信息
+func (d *OSDetector) osSetFromNTLMChallenge(source string, challenge *NTLMChallengeInfo) map[string]bool {
+	version := challenge.Version
+	if d.Verbose {
+		fmt.Printf("[%s] Detected Windows version: %d.%d.%d\n", source,
+			version.ProductMajorVersion,
+			version.ProductMinorVersion,
+			version.ProductBuild)
+		fmt.Printf("[%s] NetBIOS: %s\\%s, DNS: %s (%s)\n", source,
+			challenge.NetBIOSDomain, challenge.NetBIOSComputer, challenge.DNSComputer, challenge.DNSDomain)
+	}
+	d.addDetail("%s NTLM: Windows %d.%d.%d, %s\\%s (%s)", source,
+		version.ProductMajorVersion, version.ProductMinorVersion, version.ProductBuild,
+		challenge.NetBIOSDomain, challenge.NetBIOSComputer, challenge.DNSComputer)
+
+	resultSet := windowsOSSetFromVersion(int(version.ProductMajorVersion), int(version.ProductMinorVersion), int(version.ProductBuild))
+	for os := range resultSet {
+		d.osWeights[os] += 5
+	}
+
+	return resultSet
+}
+
+// decodeUTF16LE 解码UTF-16LE字符串
+func decodeUTF16LE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// fileTimeToTime 将Windows FILETIME（1601年起的100纳秒间隔）转换为时间
+func fileTimeToTime(ft uint64) time.Time {
+	const epochDiff = 116444736000000000 // 1601-01-01 到 1970-01-01 的100纳秒间隔数
+	if ft < epochDiff {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ft-epochDiff)*100)
+}
@@ -0,0 +1,168 @@
+package detector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// ntlmTestAVPair 编码一个UTF-16LE值的AV_PAIR
+func ntlmTestAVPair(id uint16, value string) []byte {
+	pair := binary.LittleEndian.AppendUint16(nil, id)
+	encoded := utf16.Encode([]rune(value))
+	pair = binary.LittleEndian.AppendUint16(pair, uint16(len(encoded)*2))
+	for _, u := range encoded {
+		pair = binary.LittleEndian.AppendUint16(pair, u)
+	}
+	return pair
+}
+
+// ntlmTestChallenge 构造NTLMSSP Challenge消息，version为nil时不设置NEGOTIATE_VERSION
+func ntlmTestChallenge(version []byte, targetInfo []byte) []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmNegotiateNTLM | ntlmNegotiateTargetInfo)
+	if version != nil {
+		flags |= ntlmNegotiateVersion
+	} else {
+		version = make([]byte, 8)
+	}
+
+	msg := append([]byte(nil), NTLMSSP_SIGNATURE...)
+	msg = binary.LittleEndian.AppendUint32(msg, NTLMSSP_CHALLENGE)
+	msg = append(msg, 0, 0, 0, 0, 56, 0, 0, 0) // TargetNameFields
+	msg = binary.LittleEndian.AppendUint32(msg, flags)
+	msg = append(msg, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef) // ServerChallenge
+	msg = append(msg, make([]byte, 8)...)                             // Reserved
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(targetInfo)))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(targetInfo)))
+	msg = binary.LittleEndian.AppendUint32(msg, 56)
+	msg = append(msg, version...)
+	return append(msg, targetInfo...)
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	// Windows Server 2022（10.0.20348）的Challenge，带有时间戳的完整目标信息
+	stamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var targetInfo []byte
+	targetInfo = append(targetInfo, ntlmTestAVPair(ntlmAvNbDomainName, "CORP")...)
+	targetInfo = append(targetInfo, ntlmTestAVPair(ntlmAvNbComputerName, "DC01")...)
+	targetInfo = append(targetInfo, ntlmTestAVPair(ntlmAvDNSDomainName, "corp.example.com")...)
+	targetInfo = append(targetInfo, ntlmTestAVPair(ntlmAvDNSComputerName, "dc01.corp.example.com")...)
+	targetInfo = append(targetInfo, ntlmTestAVPair(ntlmAvDNSTreeName, "corp.example.com")...)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, ntlmAvTimestamp)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, 8)
+	targetInfo = binary.LittleEndian.AppendUint64(targetInfo, uint64(stamp.UnixNano()/100)+116444736000000000)
+	targetInfo = append(targetInfo, 0, 0, 0, 0) // MsvAvEOL
+	server2022 := ntlmTestChallenge([]byte{10, 0, 0x7c, 0x4f, 0, 0, 0, 15}, targetInfo)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		version  *NTLMSSPVersion
+		computer string
+		domain   string
+		dnsName  string
+		stamp    time.Time
+	}{
+		{
+			name:     "Server 2022",
+			data:     server2022,
+			version:  &NTLMSSPVersion{ProductMajorVersion: 10, ProductBuild: 20348, NTLMRevisionCurrent: 15},
+			computer: "DC01",
+			domain:   "CORP",
+			dnsName:  "dc01.corp.example.com",
+			stamp:    stamp,
+		},
+		{
+			// CredSSP的TSRequest中NTLMSSP消息前面还有BER头部
+			name:     "wrapped in TSRequest",
+			data:     append([]byte{0x30, 0x82, 0x01, 0x00, 0xa0, 0x03, 0x02, 0x01, 0x06}, server2022...),
+			version:  &NTLMSSPVersion{ProductMajorVersion: 10, ProductBuild: 20348, NTLMRevisionCurrent: 15},
+			computer: "DC01",
+			domain:   "CORP",
+			dnsName:  "dc01.corp.example.com",
+			stamp:    stamp,
+		},
+		{
+			// Windows Server 2003（5.2.3790）的Challenge
+			name:    "Server 2003 without target info",
+			data:    ntlmTestChallenge([]byte{5, 2, 0xce, 0x0e, 0, 0, 0, 15}, nil),
+			version: &NTLMSSPVersion{ProductMajorVersion: 5, ProductMinorVersion: 2, ProductBuild: 3790, NTLMRevisionCurrent: 15},
+		},
+		{
+			// 未设置NEGOTIATE_VERSION时忽略版本字段
+			name:     "no version",
+			data:     ntlmTestChallenge(nil, ntlmTestAVPair(ntlmAvNbComputerName, "SAMBA")),
+			computer: "SAMBA",
+		},
+		{
+			name:    "target info out of range",
+			data:    ntlmTestChallenge([]byte{10, 0, 0x7c, 0x4f, 0, 0, 0, 15}, targetInfo)[:80],
+			version: &NTLMSSPVersion{ProductMajorVersion: 10, ProductBuild: 20348, NTLMRevisionCurrent: 15},
+		},
+		{name: "no signature", data: []byte("HTTP/1.1 401 Unauthorized\r\n"), wantErr: true},
+		{name: "negotiate message", data: ntlmNegotiateMessage(), wantErr: true},
+		{name: "too short", data: server2022[:40], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseNTLMChallenge(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseNTLMChallenge() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNTLMChallenge() error: %v", err)
+			}
+			switch {
+			case tt.version == nil && info.Version != nil:
+				t.Errorf("Version = %+v, want nil", info.Version)
+			case tt.version != nil && (info.Version == nil || *info.Version != *tt.version):
+				t.Errorf("Version = %+v, want %+v", info.Version, tt.version)
+			}
+			if info.NetBIOSComputer != tt.computer || info.NetBIOSDomain != tt.domain || info.DNSComputer != tt.dnsName {
+				t.Errorf("names = %q\\%q (%q), want %q\\%q (%q)",
+					info.NetBIOSDomain, info.NetBIOSComputer, info.DNSComputer, tt.domain, tt.computer, tt.dnsName)
+			}
+			if !info.Timestamp.Equal(tt.stamp) {
+				t.Errorf("Timestamp = %s, want %s", info.Timestamp, tt.stamp)
+			}
+		})
+	}
+}
+
+func TestNTLMNegotiateMessage(t *testing.T) {
+	msg := ntlmNegotiateMessage()
+	if len(msg) != 40 || !bytes.HasPrefix(msg, NTLMSSP_SIGNATURE) {
+		t.Fatalf("ntlmNegotiateMessage() = % x", msg)
+	}
+	if got := binary.LittleEndian.Uint32(msg[8:]); got != NTLMSSP_NEGOTIATE {
+		t.Errorf("MessageType = %d, want %d", got, NTLMSSP_NEGOTIATE)
+	}
+	// 必须请求版本和目标信息，否则服务器不会返回版本号和名称
+	flags := binary.LittleEndian.Uint32(msg[12:])
+	if flags&ntlmNegotiateVersion == 0 || flags&ntlmNegotiateTargetInfo == 0 {
+		t.Errorf("flags = %#08x, want NEGOTIATE_VERSION and NEGOTIATE_TARGET_INFO", flags)
+	}
+}
+
+func TestFileTimeToTime(t *testing.T) {
+	tests := []struct {
+		ft   uint64
+		want time.Time
+	}{
+		{116444736000000000, time.Unix(0, 0)},
+		{133589952000000000, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{0, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := fileTimeToTime(tt.ft); !got.Equal(tt.want) {
+			t.Errorf("fileTimeToTime(%d) = %s, want %s", tt.ft, got, tt.want)
+		}
+	}
+}
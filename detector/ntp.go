@@ -0,0 +1,308 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// NTP 报文模式
+const (
+	ntpModeClient  = 3
+	ntpModeServer  = 4
+	ntpModeControl = 6
+	ntpModePrivate = 7
+
+	ntpControlReadVar = 2 // mode 6 READVAR
+	ntpPrivateImplNTP = 3 // mode 7 IMPL_XNTPD
+	ntpPrivateSysInfo = 4 // mode 7 REQ_SYS_INFO
+)
+
+// NTPServerInfo NTP服务器指纹信息
+type NTPServerInfo struct {
+	Implementation string            // w32time、ntpd、chrony、OpenNTPD
+	Version        int               // 响应中的NTP版本号
+	Stratum        int               // 层级
+	Poll           int               // 轮询间隔（log2秒）
+	Precision      int               // 时钟精度（log2秒）
+	RootDelay      float64           // 根延迟（秒）
+	RootDispersion float64           // 根离散（秒）
+	RefID          string            // 参考标识
+	ControlVars    map[string]string // mode 6 READVAR返回的系统变量
+	PrivateReply   bool              // 是否响应mode 7请求
+}
+
+// NTPFingerprint 通过NTP协议特征识别操作系统
+func (d *OSDetector) NTPFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	// 构造NTP客户端请求包
+	request := make([]byte, 48)
+	request[0] = 0x20 | ntpModeClient // LI=0, VN=4, Mode=3
+	request[2] = 6                    // Poll=64s
+
+	response, err := udpExchange(targetIP, 123, request)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[NTP] No response: %v\n", err)
+		}
+		return resultSet
+	}
+
+	info, err := parseNTPResponse(response)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[NTP] Invalid response: %v\n", err)
+		}
+		return resultSet
+	}
+
+	// 可选的mode 6/7查询，ntpd会暴露system=和version=变量
+	if d.NTPControlQueries {
+		info.ControlVars = d.ntpReadVars(targetIP)
+		if reply, err := udpExchange(targetIP, 123, ntpPrivateRequest()); err == nil {
+			info.PrivateReply = isNTPPrivateReply(reply)
+		}
+	}
+
+	info.Implementation = identifyNTPImplementation(info)
+	d.ntpInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[NTP] Implementation: %s, VN=%d, Stratum=%d, Poll=%d, Precision=%d, RefID=%s, RootDelay=%.6fs, RootDispersion=%.6fs\n",
+			info.Implementation, info.Version, info.Stratum, info.Poll, info.Precision, info.RefID, info.RootDelay, info.RootDispersion)
+		if len(info.ControlVars) > 0 {
+			fmt.Printf("[NTP] version=%q, system=%q\n", info.ControlVars["version"], info.ControlVars["system"])
+		}
+	}
+	if info.Implementation == "" {
+		return resultSet
+	}
+	d.addDetail("NTP: %s (stratum %d, refid %s)", info.Implementation, info.Stratum, info.RefID)
+
+	// ntpd报告的system变量最可靠，例如 "Linux/5.15.0-91-generic"、"FreeBSD/13.2-RELEASE"
+	if system := info.ControlVars["system"]; system != "" {
+		resultSet = osSetFromNTPSystem(system)
+		if len(resultSet) > 0 {
+			for os := range resultSet {
+				d.osWeights[os] += 3
+			}
+			log.Println("NTP服务器报告系统信息:", system)
+			return resultSet
+		}
+	}
+
+	switch info.Implementation {
+	case "w32time":
+		resultSet = newOSSet(WindowsFamily)
+		// Windows 10/Server 2016之后的w32time精度为-23，更早的版本为-6
+		if info.Precision == -23 {
+			d.osWeights["Windows 10"] += 2
+			d.osWeights["Windows 11"] += 2
+		} else if info.Precision == -6 {
+			d.osWeights["Windows XP"] += 2
+			d.osWeights["Windows 7"] += 2
+		}
+		log.Println("NTP响应具有w32time特征，可能是Windows系统")
+	case "chrony":
+		// chrony是CentOS/RHEL 7及之后版本的默认NTP实现
+		resultSet = newOSSet(LinuxFamily)
+		d.osWeights["Centos"]++
+	case "ntpd":
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+	case "OpenNTPD":
+		resultSet = newOSSet(LinuxFamily, []string{"FreeBSD"})
+		d.osWeights["FreeBSD"]++
+	}
+	for os := range resultSet {
+		d.osWeights[os]++
+	}
+
+	return resultSet
+}
+
+// NTPServerInfo 返回NTP服务器指纹信息，未探测或无响应时为nil
+func (d *OSDetector) NTPServerInfo() *NTPServerInfo {
+	return d.ntpInfo
+}
+
+// parseNTPResponse 解析NTP服务器响应
+func parseNTPResponse(data []byte) (*NTPServerInfo, error) {
+	if len(data) < 48 {
+		return nil, fmt.Errorf("NTP response too short")
+	}
+	if data[0]&0x07 != ntpModeServer {
+		return nil, fmt.Errorf("unexpected NTP mode %d", data[0]&0x07)
+	}
+
+	info := &NTPServerInfo{
+		Version:        int(data[0]>>3) & 0x07,
+		Stratum:        int(data[1]),
+		Poll:           int(int8(data[2])),
+		Precision:      int(int8(data[3])),
+		RootDelay:      float64(binary.BigEndian.Uint32(data[4:8])) / 65536,
+		RootDispersion: float64(binary.BigEndian.Uint32(data[8:12])) / 65536,
+	}
+
+	// 层级0和1的参考标识为ASCII字符串（包括KoD代码），其余为上游服务器IPv4地址
+	refID := data[12:16]
+	if info.Stratum <= 1 {
+		info.RefID = strings.TrimRight(string(refID), "\x00")
+	} else {
+		info.RefID = net.IP(refID).String()
+	}
+
+	return info, nil
+}
+
+// identifyNTPImplementation 根据响应字段和控制查询结果识别NTP实现
+func identifyNTPImplementation(info *NTPServerInfo) string {
+	if version := strings.ToLower(info.ControlVars["version"]); version != "" {
+		switch {
+		case strings.Contains(version, "ntpsec"), strings.Contains(version, "ntpd"):
+			return "ntpd"
+		case strings.Contains(version, "chrony"):
+			return "chrony"
+		}
+	}
+	if info.PrivateReply || len(info.ControlVars) > 0 {
+		return "ntpd"
+	}
+
+	switch {
+	case info.RefID == "127.127.1.1":
+		// chrony的local指令使用127.127.1.1作为参考标识
+		return "chrony"
+	case (info.Precision == -6 || info.Precision == -23) && (info.RefID == "LOCL" || info.RootDispersion >= 7):
+		// w32time使用固定的精度值，且未同步时根离散接近10秒
+		return "w32time"
+	case info.RefID == "INIT" || info.RefID == "STEP":
+		return "ntpd"
+	case info.Stratum > 1 && info.RootDispersion == 0:
+		// OpenNTPD不维护根离散，始终报告为0
+		return "OpenNTPD"
+	}
+
+	// 其他已同步的服务器没有可区分的特征，不作为证据
+	return ""
+}
+
+// ntpReadVars 发送mode 6 READVAR请求并解析系统变量
+func (d *OSDetector) ntpReadVars(targetIP string) map[string]string {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(targetIP, "123"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	request := make([]byte, 12)
+	request[0] = 0x10 | ntpModeControl // LI=0, VN=2, Mode=6
+	request[1] = ntpControlReadVar
+	binary.BigEndian.PutUint16(request[2:4], 1) // Sequence
+	if _, err := conn.Write(request); err != nil {
+		return nil
+	}
+
+	// 响应可能分为多个分片，按偏移量重组
+	data := make([]byte, 0, 1024)
+	buffer := make([]byte, 1500)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Duration(MaxRTT) * time.Second))
+		n, err := conn.Read(buffer)
+		if err != nil || n < 12 {
+			break
+		}
+		// R=1表示响应，E=1表示错误
+		if buffer[1]&0x80 == 0 || buffer[1]&0x40 != 0 {
+			break
+		}
+
+		offset := int(binary.BigEndian.Uint16(buffer[8:10]))
+		count := int(binary.BigEndian.Uint16(buffer[10:12]))
+		if 12+count > n {
+			break
+		}
+		if offset+count > len(data) {
+			data = append(data, make([]byte, offset+count-len(data))...)
+		}
+		copy(data[offset:], buffer[12:12+count])
+
+		// M=0表示最后一个分片
+		if buffer[1]&0x20 == 0 {
+			break
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	return parseNTPVars(string(data))
+}
+
+// parseNTPVars 解析 key=value 形式的变量列表，值可能带引号且包含逗号
+func parseNTPVars(s string) map[string]string {
+	vars := make(map[string]string)
+	var fields []string
+	start, quoted := 0, false
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	fields = append(fields, s[start:])
+
+	for _, field := range fields {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			continue
+		}
+		vars[key] = strings.Trim(strings.TrimSpace(value), "\"")
+	}
+
+	return vars
+}
+
+// ntpPrivateRequest 构造mode 7 REQ_SYS_INFO请求，只有ntpd会响应
+func ntpPrivateRequest() []byte {
+	request := make([]byte, 48)
+	request[0] = 0x10 | ntpModePrivate // R=0, M=0, VN=2, Mode=7
+	request[2] = ntpPrivateImplNTP
+	request[3] = ntpPrivateSysInfo
+	return request
+}
+
+// isNTPPrivateReply 检查mode 7响应是否为没有错误码的正常响应，
+// 禁用mode 7的ntpd和其他实现会返回错误码或原样返回请求
+func isNTPPrivateReply(data []byte) bool {
+	if len(data) < 8 || data[0]&0x07 != ntpModePrivate || data[0]&0x80 == 0 {
+		return false
+	}
+	return data[4]>>4 == 0
+}
+
+// osSetFromNTPSystem 根据ntpd的system变量推断操作系统
+func osSetFromNTPSystem(system string) map[string]bool {
+	resultSet := osSetFromVersionString(system)
+	if len(resultSet) > 0 {
+		return resultSet
+	}
+
+	s := strings.ToLower(system)
+	switch {
+	case strings.HasPrefix(s, "linux/"):
+		resultSet = osSetFromLinuxKernel(system[len("linux/"):])
+	case strings.HasPrefix(s, "freebsd"):
+		resultSet["FreeBSD"] = true
+	}
+
+	return resultSet
+}
@@ -0,0 +1,148 @@
+package detector
+
+import (
+	"encoding/binary"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// ntpTestResponse 构造mode 4响应，rootDispersion以秒为单位
+func ntpTestResponse(stratum int, precision int8, rootDispersion float64, refID []byte) []byte {
+	data := make([]byte, 48)
+	data[0] = 0x20 | ntpModeServer // LI=0, VN=4, Mode=4
+	data[1] = byte(stratum)
+	data[2] = 6
+	data[3] = byte(precision)
+	binary.BigEndian.PutUint32(data[8:12], uint32(rootDispersion*65536))
+	copy(data[12:16], refID)
+	return data
+}
+
+func TestParseNTPResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   bool
+		version   int
+		stratum   int
+		precision int
+		refID     string
+	}{
+		{name: "ntpd INIT", data: ntpTestResponse(0, -20, 0, []byte("INIT")), version: 4, stratum: 0, precision: -20, refID: "INIT"},
+		{name: "GPS stratum 1", data: ntpTestResponse(1, -20, 0, []byte("GPS\x00")), version: 4, stratum: 1, precision: -20, refID: "GPS"},
+		{name: "upstream IPv4", data: ntpTestResponse(2, -24, 0.03, []byte{192, 168, 1, 1}), version: 4, stratum: 2, precision: -24, refID: "192.168.1.1"},
+		{name: "too short", data: make([]byte, 47), wantErr: true},
+		{name: "client mode", data: append([]byte{0x23}, make([]byte, 47)...), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseNTPResponse(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseNTPResponse() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNTPResponse() error: %v", err)
+			}
+			if info.Version != tt.version || info.Stratum != tt.stratum || info.Precision != tt.precision || info.RefID != tt.refID {
+				t.Errorf("parseNTPResponse() = VN=%d Stratum=%d Precision=%d RefID=%q, want VN=%d Stratum=%d Precision=%d RefID=%q",
+					info.Version, info.Stratum, info.Precision, info.RefID, tt.version, tt.stratum, tt.precision, tt.refID)
+			}
+		})
+	}
+}
+
+func TestIdentifyNTPImplementation(t *testing.T) {
+	tests := []struct {
+		name string
+		info *NTPServerInfo
+		want string
+	}{
+		{"ntpd version", &NTPServerInfo{Stratum: 2, RootDispersion: 0.03, ControlVars: map[string]string{"version": "ntpd 4.2.8p15@1.3728-o"}}, "ntpd"},
+		{"ntpsec version", &NTPServerInfo{Stratum: 2, RootDispersion: 0.03, ControlVars: map[string]string{"version": "ntpsec-1.2.2"}}, "ntpd"},
+		{"mode 7 reply", &NTPServerInfo{Stratum: 2, RootDispersion: 0.03, PrivateReply: true}, "ntpd"},
+		{"chrony local", &NTPServerInfo{Stratum: 10, RootDispersion: 0.001, RefID: "127.127.1.1"}, "chrony"},
+		{"w32time unsynchronized", &NTPServerInfo{Stratum: 1, Precision: -23, RootDispersion: 10, RefID: "LOCL"}, "w32time"},
+		{"w32time legacy", &NTPServerInfo{Stratum: 2, Precision: -6, RootDispersion: 7.8, RefID: "10.0.0.1"}, "w32time"},
+		{"ntpd unsynchronized", &NTPServerInfo{Stratum: 0, Precision: -20, RefID: "INIT"}, "ntpd"},
+		{"OpenNTPD", &NTPServerInfo{Stratum: 3, Precision: -20, RefID: "10.0.0.1"}, "OpenNTPD"},
+		{"synchronized without evidence", &NTPServerInfo{Stratum: 2, Precision: -24, RootDispersion: 0.03, RefID: "10.0.0.1"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifyNTPImplementation(tt.info); got != tt.want {
+				t.Errorf("identifyNTPImplementation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNTPPrivateReply(t *testing.T) {
+	reply := func(first, errNibble byte) []byte {
+		data := make([]byte, 48)
+		data[0] = first
+		data[2], data[3] = ntpPrivateImplNTP, ntpPrivateSysInfo
+		data[4] = errNibble << 4
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"sys_info response", reply(0x80|0x10|ntpModePrivate, 0), true},
+		{"INFO_ERR_NODATA", reply(0x80|0x10|ntpModePrivate, 4), false},
+		{"echoed request", ntpPrivateRequest(), false},
+		{"mode 4", reply(0x80|0x10|ntpModeServer, 0), false},
+		{"too short", reply(0x80|0x10|ntpModePrivate, 0)[:7], false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNTPPrivateReply(tt.data); got != tt.want {
+				t.Errorf("isNTPPrivateReply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNTPVars(t *testing.T) {
+	vars := parseNTPVars(`version="ntpd 4.2.8p15@1.3728-o Wed Sep 23 11:46:38 UTC 2020 (1)", processor="x86_64", system="Linux/5.15.0-91-generic", leap=0, stratum=2`)
+
+	want := map[string]string{
+		"version":   "ntpd 4.2.8p15@1.3728-o Wed Sep 23 11:46:38 UTC 2020 (1)",
+		"processor": "x86_64",
+		"system":    "Linux/5.15.0-91-generic",
+		"leap":      "0",
+		"stratum":   "2",
+	}
+	if !maps.Equal(vars, want) {
+		t.Errorf("parseNTPVars() = %v, want %v", vars, want)
+	}
+}
+
+func TestOSSetFromNTPSystem(t *testing.T) {
+	tests := []struct {
+		system string
+		want   []string
+	}{
+		{"Linux/5.15.0-91-generic", []string{"Ubuntu"}},
+		{"Linux/6.1.0-13-amd64", []string{"Debain"}},
+		{"Linux/4.18.0-513.5.1.el8_9.x86_64", []string{"Centos"}},
+		{"FreeBSD/13.2-RELEASE", []string{"FreeBSD"}},
+		{"UNIX", nil},
+	}
+
+	for _, tt := range tests {
+		got := slices.Sorted(maps.Keys(osSetFromNTPSystem(tt.system)))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("osSetFromNTPSystem(%q) = %v, want %v", tt.system, got, tt.want)
+		}
+	}
+}
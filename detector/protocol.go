@@ -1,9 +1,10 @@
 package detector
 
 import (
-	"encoding/binary"
 	"fmt"
+	"log"
 	"net"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -13,46 +14,40 @@ type ProtocolDetector struct {
 	Verbose bool
 }
 
-// TCPStackFingerprint 通过TCP协议栈特征识别操作系统
+// TCPStackFingerprint 通过SYN/ACK的TCP选项顺序、窗口缩放值和时间戳回显识别操作系统
 func (d *OSDetector) TCPStackFingerprint(targetIP string) map[string]bool {
 	resultSet := make(map[string]bool)
 
-	// 尝试建立TCP连接以获取协议栈特征
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:80"), time.Duration(MaxRTT)*time.Second)
-	if err != nil {
+	// 只有第一个SEQ探测的响应与签名库对应
+	var resp *tcpResponse
+	for _, r := range d.collectSEQResponses(targetIP) {
+		if d.Verbose {
+			fmt.Printf("[TCP Stack] O%d=%s W%d=%X TTL=%d\n", r.Probe+1, tcpOptionSignature(r.Options), r.Probe+1, r.Window, r.IP.TTL)
+		}
+		if r.Probe == 0 {
+			resp = r
+		}
+	}
+	if resp == nil {
 		return resultSet
 	}
-	defer conn.Close()
-
-	// 获取TCP连接信息
-	tcpConn := conn.(*net.TCPConn)
-
-	// 获取本地地址信息
-	localAddr := tcpConn.LocalAddr().(*net.TCPAddr)
 
-	// 获取远程地址信息
-	remoteAddr := tcpConn.RemoteAddr().(*net.TCPAddr)
-
-	if d.Verbose {
-		fmt.Printf("[TCP Stack] Local: %s, Remote: %s\n", localAddr, remoteAddr)
+	signature := tcpOptionSignature(resp.Options)
+	resultSet = matchTCPFeatures(resp.Options, OSDB)
+	d.addDetail("TCP options: O1=%s, W1=%X", signature, resp.Window)
+	if len(resultSet) == 0 {
+		return resultSet
 	}
 
-	// 根据TTL值判断操作系统
-	ttl := remoteAddr.IP.DefaultMask().String()
-	if d.Verbose {
-		fmt.Printf("[TCP Stack] TTL: %s\n", ttl)
+	// 选项顺序由协议栈实现决定，是区分度最高的特征之一
+	weight := 5
+	if _, ok := OSDB["TCP Options"][signature]; !ok {
+		weight = 3
 	}
-
-	// 根据TTL值匹配操作系统
-	for os, features := range OSDB {
-		if ttlFeatures, ok := features["TTL"]; ok {
-			for _, ttlValue := range ttlFeatures {
-				if ttl == ttlValue {
-					resultSet[os] = true
-				}
-			}
-		}
+	for os := range resultSet {
+		d.osWeights[os] += weight
 	}
+	log.Printf("TCP选项签名 %s 匹配: %s\n", signature, d.formatOSSet(resultSet))
 
 	return resultSet
 }
@@ -62,14 +57,18 @@ func (d *OSDetector) HTTPFingerprint(targetIP string) map[string]bool {
 	resultSet := make(map[string]bool)
 
 	// 发送HTTP请求
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:80"), time.Duration(MaxRTT)*time.Second)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "80"), time.Duration(MaxRTT)*time.Second)
 	if err != nil {
 		return resultSet
 	}
 	defer conn.Close()
 
-	// 发送HTTP请求
-	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", targetIP)
+	// 发送HTTP请求，IPv6地址在Host头中需要加方括号
+	host := targetIP
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", host)
 
 	// 读取响应头
 	buffer := make([]byte, 1024)
@@ -89,19 +88,13 @@ func (d *OSDetector) HTTPFingerprint(targetIP string) map[string]bool {
 			fmt.Printf("[HTTP] Server: %s\n", serverHeader)
 		}
 
-		// 根据Server头识别操作系统
-		if strings.Contains(serverHeader, "Apache") {
-			resultSet["Linux"] = true
-			resultSet["Centos"] = true
-			resultSet["Ubuntu"] = true
-			resultSet["Debian"] = true
+		// 根据Server头识别操作系统，例如 "Apache/2.4.52 (Ubuntu)"、"Apache/2.4.58 (Win64)"
+		if versionSet := osSetFromVersionString(serverHeader); len(versionSet) > 0 {
+			resultSet = versionSet
 		} else if strings.Contains(serverHeader, "Microsoft-IIS") {
-			resultSet["Windows"] = true
-		} else if strings.Contains(serverHeader, "nginx") {
-			resultSet["Linux"] = true
-			resultSet["Centos"] = true
-			resultSet["Ubuntu"] = true
-			resultSet["Debian"] = true
+			resultSet = newOSSet(WindowsFamily)
+		} else if strings.Contains(serverHeader, "Apache") || strings.Contains(serverHeader, "nginx") {
+			resultSet = newOSSet(LinuxFamily)
 		}
 	}
 
@@ -113,7 +106,7 @@ func (d *OSDetector) SSHFingerprint(targetIP string) map[string]bool {
 	resultSet := make(map[string]bool)
 
 	// 尝试建立SSH连接
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:22"), time.Duration(MaxRTT)*time.Second)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "22"), time.Duration(MaxRTT)*time.Second)
 	if err != nil {
 		return resultSet
 	}
@@ -131,116 +124,82 @@ func (d *OSDetector) SSHFingerprint(targetIP string) map[string]bool {
 		fmt.Printf("[SSH] Version: %s\n", version)
 	}
 
-	// 根据SSH版本识别操作系统
-	if strings.Contains(version, "OpenSSH") {
-		resultSet["Linux"] = true
-		resultSet["Centos"] = true
-		resultSet["Ubuntu"] = true
-		resultSet["Debian"] = true
-		resultSet["FreeBSD"] = true
+	// 根据SSH版本识别操作系统，例如 "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"、"SSH-2.0-OpenSSH_for_Windows_8.1"
+	if versionSet := osSetFromVersionString(version); len(versionSet) > 0 {
+		resultSet = versionSet
+	} else if strings.Contains(version, "OpenSSH") {
+		resultSet = newOSSet(LinuxFamily, BSDFamily)
 	}
 
 	return resultSet
 }
 
-// DNSFingerprint 通过DNS查询特征识别操作系统
-func (d *OSDetector) DNSFingerprint(targetIP string) map[string]bool {
+// tcpMSSPattern 签名中的MSS部分，MSS随路径MTU变化，模糊匹配时忽略
+var tcpMSSPattern = regexp.MustCompile(`M[0-9A-F]+`)
+
+// matchTCPFeatures 匹配SYN/ACK的TCP选项签名，签名不在数据库中时忽略MSS数值再匹配
+func matchTCPFeatures(options []byte, features map[string]map[interface{}][]string) map[string]bool {
 	resultSet := make(map[string]bool)
 
-	// 发送DNS查询
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:53"), time.Duration(MaxRTT)*time.Second)
-	if err != nil {
+	signature := tcpOptionSignature(options)
+	if signature == "" {
 		return resultSet
 	}
-	defer conn.Close()
-
-	// 构造DNS查询包
-	query := make([]byte, 12)
-	binary.BigEndian.PutUint16(query[0:2], 0x1234)   // ID
-	query[2] = 0x01                                  // QR=0, Opcode=0
-	query[3] = 0x00                                  // AA=0, TC=0, RD=1
-	binary.BigEndian.PutUint16(query[4:6], 0x0001)   // QDCOUNT=1
-	binary.BigEndian.PutUint16(query[6:8], 0x0000)   // ANCOUNT=0
-	binary.BigEndian.PutUint16(query[8:10], 0x0000)  // NSCOUNT=0
-	binary.BigEndian.PutUint16(query[10:12], 0x0000) // ARCOUNT=0
-
-	// 发送查询
-	_, err = conn.Write(query)
-	if err != nil {
-		return resultSet
+	if osList, ok := features["TCP Options"][signature]; ok {
+		return newOSSet(osList)
 	}
 
-	// 读取响应
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	if err != nil {
-		return resultSet
-	}
-
-	// 分析DNS响应特征
-	if n > 0 {
-		// Windows DNS响应通常包含特定的标志位
-		if buffer[2]&0x80 == 0x80 { // QR=1
-			resultSet["Windows"] = true
-		} else {
-			resultSet["Linux"] = true
-			resultSet["Centos"] = true
-			resultSet["Ubuntu"] = true
-			resultSet["Debian"] = true
-			resultSet["FreeBSD"] = true
+	// 经过VPN或隧道时MSS会变小，窗口大小和MSS也随路径变化，只比较选项顺序
+	normalized := tcpMSSPattern.ReplaceAllString(signature, "M")
+	for key, osList := range features["TCP Options"] {
+		if tcpMSSPattern.ReplaceAllString(key.(string), "M") == normalized {
+			for _, os := range osList {
+				resultSet[os] = true
+			}
 		}
 	}
 
 	return resultSet
 }
 
-// NTPFingerprint 通过NTP协议特征识别操作系统
-func (d *OSDetector) NTPFingerprint(targetIP string) map[string]bool {
-	resultSet := make(map[string]bool)
-
-	// 发送NTP请求
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:123"), time.Duration(MaxRTT)*time.Second)
-	if err != nil {
-		return resultSet
-	}
-	defer conn.Close()
-
-	// 构造NTP请求包
-	request := make([]byte, 48)
-	request[0] = 0x1b // LI=0, VN=3, Mode=3
-
-	// 发送请求
-	_, err = conn.Write(request)
-	if err != nil {
-		return resultSet
-	}
-
-	// 读取响应
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	if err != nil {
-		return resultSet
-	}
-
-	// 分析NTP响应特征
-	if n > 0 {
-		// Windows NTP响应通常包含特定的标志位
-		if buffer[0]&0x07 == 0x04 { // Mode=4
-			resultSet["Windows"] = true
-		} else {
-			resultSet["Linux"] = true
-			resultSet["Centos"] = true
-			resultSet["Ubuntu"] = true
-			resultSet["Debian"] = true
-			resultSet["FreeBSD"] = true
+// tcpOptionSignature 将TCP选项转换为nmap格式的签名，例如 "M5B4ST11NW7"：
+// M为MSS，N为NOP，W为窗口缩放值，S为SACK permitted，T后两位表示TSval和TSecr是否非0，L为EOL
+func tcpOptionSignature(options []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(options); {
+		kind := options[i]
+		switch kind {
+		case 0:
+			b.WriteString("L")
+			i++
+			continue
+		case 1:
+			b.WriteString("N")
+			i++
+			continue
+		}
+		if i+1 >= len(options) || options[i+1] < 2 || i+int(options[i+1]) > len(options) {
+			break
 		}
+		data := options[i+2 : i+int(options[i+1])]
+		switch {
+		case kind == 2 && len(data) == 2:
+			fmt.Fprintf(&b, "M%X", int(data[0])<<8|int(data[1]))
+		case kind == 3 && len(data) == 1:
+			fmt.Fprintf(&b, "W%X", data[0])
+		case kind == 4:
+			b.WriteString("S")
+		case kind == 8 && len(data) == 8:
+			b.WriteString("T")
+			for _, part := range [][]byte{data[0:4], data[4:8]} {
+				if part[0]|part[1]|part[2]|part[3] != 0 {
+					b.WriteString("1")
+				} else {
+					b.WriteString("0")
+				}
+			}
+		}
+		i += int(options[i+1])
 	}
-
-	return resultSet
-}
-
-// matchTCPFeatures 匹配TCP特征
-func matchTCPFeatures(windowSize, mss int, options []byte, features map[interface{}][]string) bool {
-	// 实现TCP特征匹配逻辑
-	return false
+	return b.String()
 }
@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTCPOptionSignature(t *testing.T) {
+	ts := []byte{8, 10, 0, 0, 0x12, 0x34, 0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		name    string
+		options []byte
+		want    string
+	}{
+		{"Linux", linuxSYNACKOptions(0x1234), "M5B4ST11NW7"},
+		{"Windows 10", append([]byte{2, 4, 5, 180, 1, 3, 3, 8, 4, 2}, ts...), "M5B4NW8ST11"},
+		{"Windows 7 without timestamp", windowsSYNACKOptions, "M5B4NW8NNS"},
+		{"Windows XP", []byte{2, 4, 5, 180, 1, 3, 3, 0, 1, 1, 8, 10, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 4, 2}, "M5B4NW0NNT00NNS"},
+		{"macOS", append(append([]byte{2, 4, 5, 180, 1, 3, 3, 6, 1, 1}, ts...), 4, 2, 0, 0), "M5B4NW6NNT11SLL"},
+		{"FreeBSD", append([]byte{2, 4, 5, 180, 1, 3, 3, 6, 4, 2}, ts...), "M5B4NW6ST11"},
+		{"TSecr zero", []byte{8, 10, 0, 0, 0, 1, 0, 0, 0, 0}, "T10"},
+		{"MSS only", []byte{2, 4, 0x02, 0x18}, "M218"},
+		{"empty", nil, ""},
+		{"truncated option", []byte{2, 4, 5}, ""},
+		{"zero length option", []byte{1, 2, 0, 5, 180}, "N"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tcpOptionSignature(tt.options); got != tt.want {
+				t.Errorf("tcpOptionSignature(% x) = %q, want %q", tt.options, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTCPFeatures(t *testing.T) {
+	linux := []string{"Centos", "Debain", "Linux", "Ubuntu"}
+
+	tests := []struct {
+		name    string
+		options []byte
+		want    []string
+	}{
+		{"Linux", linuxSYNACKOptions(0x1234), linux},
+		// 经过PPPoE或VPN后MSS变为1400，按选项顺序仍匹配Linux
+		{"Linux behind tunnel", append([]byte{2, 4, 0x05, 0x78}, linuxSYNACKOptions(0x1234)[4:]...), linux},
+		{"FreeBSD", append([]byte{2, 4, 5, 180, 1, 3, 3, 6, 4, 2}, 8, 10, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff), []string{"FreeBSD"}},
+		{"Windows XP", []byte{2, 4, 5, 180, 1, 3, 3, 0, 1, 1, 8, 10, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 4, 2}, []string{"Windows Server 2003", "Windows XP"}},
+		{"unknown order", []byte{4, 2, 2, 4, 5, 180}, nil},
+		{"no options", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slices.Sorted(maps.Keys(matchTCPFeatures(tt.options, OSDB)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matchTCPFeatures(%s) = %v, want %v", tcpOptionSignature(tt.options), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOSSetFromVersionString(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"Apache/2.4.52 (Ubuntu)", []string{"Ubuntu"}},
+		{"Apache/2.4.57 (Debian)", []string{"Debain"}},
+		{"Apache/2.4.37 (CentOS)", []string{"Centos"}},
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6", []string{"Ubuntu"}},
+		{"SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u1", []string{"Debain"}},
+		{"SSH-2.0-OpenSSH_9.3 FreeBSD-20230316", []string{"FreeBSD"}},
+		{"SSH-2.0-OpenSSH_for_Windows_8.1", slices.Sorted(slices.Values(WindowsFamily))},
+		{"nginx/1.24.0", nil},
+	}
+
+	for _, tt := range tests {
+		got := slices.Sorted(maps.Keys(osSetFromVersionString(tt.version)))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("osSetFromVersionString(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"slices"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// TCP标志位
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpPSH = 0x08
+	tcpACK = 0x10
+	tcpURG = 0x20
+	tcpECE = 0x40
+	tcpCWR = 0x80
+)
+
+// tcpProbe 原始TCP探测报文参数
+type tcpProbe struct {
+	DstPort  int
+	Flags    int
+	Window   int
+	Options  []byte
+	Seq      uint32
+	Ack      uint32
+	Urgent   int
+	Reserved int // 数据偏移之后的4个保留位
+	DF       bool
+}
+
+// tcpResponse 收到的TCP响应报文
+type tcpResponse struct {
+	Probe    int // 对应的探测序号
+	IP       *ipv4.Header
+	Seq      uint32
+	Ack      uint32
+	Flags    int
+	Reserved int // 数据偏移之后的保留位
+	Window   int
+	Urgent   int
+	Options  []byte
+	Payload  []byte
+	Sent     time.Time
+	Received time.Time
+}
+
+// seqProbes nmap SEQ测试使用的6个SYN探测，窗口大小和选项顺序各不相同
+var seqProbes = []tcpProbe{
+	{Window: 1, Options: []byte{3, 3, 10, 1, 2, 4, 5, 180, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 4, 2}},
+	{Window: 63, Options: []byte{2, 4, 5, 120, 3, 3, 0, 4, 2, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 0}},
+	{Window: 4, Options: []byte{8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 1, 1, 3, 3, 5, 1, 2, 4, 2, 128}},
+	{Window: 4, Options: []byte{4, 2, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 3, 3, 10, 0}},
+	{Window: 16, Options: []byte{2, 4, 2, 24, 4, 2, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 3, 3, 10, 0}},
+	{Window: 512, Options: []byte{2, 4, 1, 9, 4, 2, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0}},
+}
+
+// seqProbeInterval SEQ探测之间的发送间隔
+const seqProbeInterval = 100 * time.Millisecond
+
+// rawTCPSession 通过原始套接字收发TCP报文，需要root权限
+type rawTCPSession struct {
+	conn *ipv4.RawConn
+	src  net.IP
+	dst  net.IP
+}
+
+// newRawTCPSession 创建到目标的原始TCP会话
+func newRawTCPSession(targetIP string) (*rawTCPSession, error) {
+	dst, src, err := localIPv4For(targetIP)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ipv4.NewRawConn(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &rawTCPSession{conn: conn, src: src, dst: dst}, nil
+}
+
+// localIPv4For 返回目标地址和系统路由选择的本地源地址，原始套接字探测只支持IPv4
+func localIPv4For(targetIP string) (net.IP, net.IP, error) {
+	dst := net.ParseIP(targetIP).To4()
+	if dst == nil {
+		return nil, nil, fmt.Errorf("raw probes only support IPv4 targets: %s", targetIP)
+	}
+	udp, err := net.Dial("udp4", net.JoinHostPort(targetIP, "9"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer udp.Close()
+	return dst, udp.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
+
+// Close 关闭原始套接字
+func (s *rawTCPSession) Close() {
+	s.conn.Close()
+}
+
+// exchange 使用随机源端口发送探测并等待响应，超时后最多重发attempts次
+func (s *rawTCPSession) exchange(p *tcpProbe, attempts int) (*tcpResponse, error) {
+	srcPort := 32768 + rand.Intn(28000)
+	for attempt := 0; attempt <= attempts; attempt++ {
+		sent, err := s.send(p, srcPort)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.receive(srcPort, p.DstPort, sent.Add(time.Duration(MaxRTT)*time.Second))
+		if err == nil {
+			resp.Sent = sent
+			return resp, nil
+		}
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no TCP response from %s:%d", s.dst, p.DstPort)
+}
+
+// send 构造IP和TCP头部并发送
+func (s *rawTCPSession) send(p *tcpProbe, srcPort int) (time.Time, error) {
+	segment := marshalTCPSegment(s.src, s.dst, srcPort, p)
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TotalLen: ipv4.HeaderLen + len(segment),
+		ID:       rand.Intn(0x10000),
+		TTL:      64,
+		Protocol: 6,
+		Src:      s.src,
+		Dst:      s.dst,
+	}
+	if p.DF {
+		header.Flags = ipv4.DontFragment
+	}
+	sent := time.Now()
+	return sent, s.conn.WriteTo(header, segment, nil)
+}
+
+// receive 读取来自目标指定端口、发往srcPort的TCP报文，忽略其他流量
+func (s *rawTCPSession) receive(srcPort, dstPort int, deadline time.Time) (*tcpResponse, error) {
+	resp, _, err := s.receiveAny(dstPort, deadline, func(port int) bool { return port == srcPort })
+	return resp, err
+}
+
+// receiveAny 读取来自目标指定端口、发往任一满足match条件的本地端口的TCP报文，同时返回本地端口
+func (s *rawTCPSession) receiveAny(dstPort int, deadline time.Time, match func(srcPort int) bool) (*tcpResponse, int, error) {
+	s.conn.SetReadDeadline(deadline)
+	buffer := make([]byte, 1500)
+	for {
+		h, payload, _, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !h.Src.Equal(s.dst) || len(payload) < 20 {
+			continue
+		}
+		srcPort := int(binary.BigEndian.Uint16(payload[2:4]))
+		if int(binary.BigEndian.Uint16(payload[0:2])) != dstPort || !match(srcPort) {
+			continue
+		}
+		resp := parseTCPSegment(payload)
+		if resp == nil {
+			continue
+		}
+		resp.IP = h
+		resp.Received = time.Now()
+		return resp, srcPort, nil
+	}
+}
+
+// marshalTCPSegment 序列化TCP头部并计算校验和，选项按4字节对齐补零
+func marshalTCPSegment(src, dst net.IP, srcPort int, p *tcpProbe) []byte {
+	options := p.Options
+	for len(options)%4 != 0 {
+		options = append(options[:len(options):len(options)], 0)
+	}
+	segment := make([]byte, 20+len(options))
+	binary.BigEndian.PutUint16(segment[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(segment[2:4], uint16(p.DstPort))
+	binary.BigEndian.PutUint32(segment[4:8], p.Seq)
+	binary.BigEndian.PutUint32(segment[8:12], p.Ack)
+	segment[12] = byte(len(segment)/4)<<4 | byte(p.Reserved&0x0f)
+	segment[13] = byte(p.Flags)
+	binary.BigEndian.PutUint16(segment[14:16], uint16(p.Window))
+	binary.BigEndian.PutUint16(segment[18:20], uint16(p.Urgent))
+	copy(segment[20:], options)
+
+	// 伪首部：源地址、目的地址、协议号和TCP长度
+	pseudo := make([]byte, 12, 12+len(segment))
+	copy(pseudo[0:4], src.To4())
+	copy(pseudo[4:8], dst.To4())
+	pseudo[9] = 6
+	binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+	binary.BigEndian.PutUint16(segment[16:18], internetChecksum(append(pseudo, segment...)))
+	return segment
+}
+
+// parseTCPSegment 解析TCP头部、选项和载荷
+func parseTCPSegment(data []byte) *tcpResponse {
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return nil
+	}
+	return &tcpResponse{
+		Seq:      binary.BigEndian.Uint32(data[4:8]),
+		Ack:      binary.BigEndian.Uint32(data[8:12]),
+		Reserved: int(data[12] & 0x0f),
+		Flags:    int(data[13]),
+		Window:   int(binary.BigEndian.Uint16(data[14:16])),
+		Urgent:   int(binary.BigEndian.Uint16(data[18:20])),
+		Options:  data[20:offset],
+		Payload:  data[offset:],
+	}
+}
+
+// internetChecksum 计算RFC 1071校验和
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// collectSEQResponses 按100ms间隔向开放端口发送SEQ探测，结果缓存供ISN、IP ID和时间戳分析共用
+func (d *OSDetector) collectSEQResponses(targetIP string) []*tcpResponse {
+	if d.seqCollected {
+		return d.seqResponses
+	}
+	d.seqCollected = true
+
+	port := d.lastCheckedPort
+	if port == 0 {
+		var err error
+		if port, err = d.findOpenTCPPort(targetIP); err != nil {
+			return nil
+		}
+	}
+	session, err := newRawTCPSession(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[TCP SEQ] Failed to open raw socket: %v\n", err)
+		}
+		return nil
+	}
+	defer session.Close()
+
+	// 与nmap一致，6个探测严格按间隔发送，每个探测使用不同的源端口，响应在发送间隙和最后统一收集，
+	// 不会因为某个探测没有响应而推迟后续探测
+	basePort := 32768 + rand.Intn(28000-len(seqProbes))
+	sent := make([]time.Time, len(seqProbes))
+	responses := make([]*tcpResponse, len(seqProbes))
+	collect := func(deadline time.Time, stopWhenComplete bool) {
+		for {
+			resp, srcPort, err := session.receiveAny(port, deadline, func(srcPort int) bool {
+				i := srcPort - basePort
+				return i >= 0 && i < len(seqProbes) && !sent[i].IsZero() && responses[i] == nil
+			})
+			if err != nil {
+				return
+			}
+			if resp.Flags&(tcpSYN|tcpACK) != tcpSYN|tcpACK {
+				continue
+			}
+			i := srcPort - basePort
+			resp.Probe, resp.Sent = i, sent[i]
+			responses[i] = resp
+			if stopWhenComplete && !slices.Contains(responses, nil) {
+				return
+			}
+		}
+	}
+
+	start := time.Now()
+	for i := range seqProbes {
+		collect(start.Add(time.Duration(i)*seqProbeInterval), false)
+		p := seqProbes[i]
+		p.DstPort = port
+		p.Flags = tcpSYN
+		p.Seq = rand.Uint32()
+		if sent[i], err = session.send(&p, basePort+i); err != nil {
+			sent[i] = time.Time{}
+		}
+	}
+	collect(time.Now().Add(time.Duration(MaxRTT)*time.Second), true)
+
+	for _, resp := range responses {
+		if resp != nil {
+			d.seqResponses = append(d.seqResponses, resp)
+		}
+	}
+	if d.Verbose {
+		fmt.Printf("[TCP SEQ] %d/%d SYN/ACK responses from port %d\n", len(d.seqResponses), len(seqProbes), port)
+	}
+	return d.seqResponses
+}
+
+// findTCPOption 返回指定类型TCP选项的数据部分，不存在时返回nil
+func findTCPOption(options []byte, kind byte) []byte {
+	for i := 0; i < len(options); {
+		switch options[i] {
+		case 0:
+			return nil
+		case 1:
+			i++
+			continue
+		}
+		if i+1 >= len(options) || options[i+1] < 2 || i+int(options[i+1]) > len(options) {
+			return nil
+		}
+		if options[i] == kind {
+			return options[i+2 : i+int(options[i+1])]
+		}
+		i += int(options[i+1])
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package detector
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// RDP 安全协议
+const (
+	rdpProtocolRDP    = 0x00000000
+	rdpProtocolSSL    = 0x00000001
+	rdpProtocolHybrid = 0x00000002
+	rdpProtocolRDSTLS = 0x00000004
+)
+
+// RDP 协商响应类型和标志
+const (
+	rdpNegTypeRequest  = 0x01
+	rdpNegTypeResponse = 0x02
+
+	rdpNegRspExtendedClientData = 0x01 // xrdp和FreeRDP服务器也会设置，不能作为Windows证据
+	rdpNegRspDynvcGFX           = 0x02 // Windows 8/Server 2012 之后支持
+	rdpNegRspRestrictedAdmin    = 0x08 // Windows 8.1/Server 2012 R2 之后支持
+)
+
+// rdpProtocolProbes 逐个请求的安全协议，CredSSP需要同时声明TLS
+var rdpProtocolProbes = []struct {
+	name      string
+	requested uint32
+	selected  uint32
+}{
+	{"RDP", rdpProtocolRDP, rdpProtocolRDP},
+	{"TLS", rdpProtocolSSL, rdpProtocolSSL},
+	{"CredSSP", rdpProtocolSSL | rdpProtocolHybrid, rdpProtocolHybrid},
+	{"RDSTLS", rdpProtocolRDSTLS, rdpProtocolRDSTLS},
+}
+
+// RDPInfo RDP协商和CredSSP信息
+type RDPInfo struct {
+	Protocols   []string           // 服务器接受的安全协议
+	NegFlags    byte               // RDP_NEG_RSP中的标志
+	Legacy      bool               // 不支持协商，只支持标准RDP安全（Windows XP/2003）
+	CertSubject string             // TLS证书主题
+	NTLM        *NTLMChallengeInfo // CredSSP中的NTLMSSP Challenge
+}
+
+// rdpNegResult X.224 Connection Confirm中的协商结果
+type rdpNegResult struct {
+	Type  byte // 0表示响应中没有协商数据
+	Flags byte
+	Value uint32 // 选择的协议或失败代码
+}
+
+// RDPFingerprint 通过RDP安全协议协商和CredSSP中的NTLMSSP识别Windows版本
+func (d *OSDetector) RDPFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+	info := &RDPInfo{}
+
+	for i, probe := range rdpProtocolProbes {
+		conn, neg, err := rdpConnect(targetIP, probe.requested)
+		if err != nil {
+			if i == 0 {
+				if d.Verbose {
+					fmt.Printf("[RDP] Failed to connect: %v\n", err)
+				}
+				return resultSet
+			}
+			continue
+		}
+		conn.Close()
+
+		// 不返回协商数据说明服务器早于RDP 5.2的协商机制
+		if neg.Type == 0 {
+			info.Legacy = true
+			info.Protocols = []string{"RDP"}
+			break
+		}
+		if neg.Type == rdpNegTypeResponse && neg.Value == probe.selected {
+			info.Protocols = append(info.Protocols, probe.name)
+			info.NegFlags |= neg.Flags
+		}
+	}
+
+	if info.supports("CredSSP") {
+		info.NTLM, info.CertSubject = d.rdpCredSSPChallenge(targetIP)
+	} else if info.supports("TLS") {
+		if conn, _, err := rdpConnect(targetIP, rdpProtocolSSL); err == nil {
+			tlsConn := tls.Client(conn, rdpTLSConfig())
+			if tlsConn.Handshake() == nil {
+				info.CertSubject = tlsCertSubject(tlsConn)
+			}
+			tlsConn.Close()
+		}
+	}
+	d.rdpInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[RDP] Protocols: %s, Flags: %#02x, Legacy: %v, Certificate: %s\n",
+			strings.Join(info.Protocols, "/"), info.NegFlags, info.Legacy, info.CertSubject)
+	}
+	d.addDetail("RDP: %s (flags %#02x) %s", strings.Join(info.Protocols, "/"), info.NegFlags, info.CertSubject)
+
+	if info.NTLM != nil && info.NTLM.Version != nil {
+		return d.osSetFromNTLMChallenge("RDP", info.NTLM)
+	}
+
+	switch {
+	case info.Legacy:
+		resultSet["Windows XP"] = true
+		d.osWeights["Windows XP"] += 3
+		log.Println("RDP服务不支持安全协议协商，可能是Windows XP/Server 2003")
+	case info.supports("CredSSP") || info.NegFlags&(rdpNegRspDynvcGFX|rdpNegRspRestrictedAdmin) != 0:
+		resultSet = newOSSet(WindowsFamily)
+		delete(resultSet, "Windows XP")
+		switch {
+		case info.NegFlags&rdpNegRspRestrictedAdmin != 0:
+			d.osWeights["Windows 10"] += 2
+			d.osWeights["Windows 11"] += 2
+		case info.NegFlags&rdpNegRspDynvcGFX != 0:
+			d.osWeights["Windows 8"] += 2
+		default:
+			d.osWeights["Windows 7"] += 2
+		}
+		log.Println("RDP安全协议协商具有Windows特征")
+	default:
+		// 只支持RDP/TLS且没有Windows特有的协商标志，可能是Linux上的xrdp
+		log.Println("RDP服务不支持CredSSP，可能是xrdp等非Windows实现")
+	}
+
+	return resultSet
+}
+
+// RDPInfo 返回RDP协商信息，未探测或无响应时为nil
+func (d *OSDetector) RDPInfo() *RDPInfo {
+	return d.rdpInfo
+}
+
+// rdpConnect 发送携带RDP_NEG_REQ的X.224 Connection Request并解析Connection Confirm
+func rdpConnect(targetIP string, requested uint32) (net.Conn, *rdpNegResult, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(targetIP, "3389"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+
+	// TPKT头部(4) + X.224 CR(7) + RDP_NEG_REQ(8)
+	request := []byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, rdpNegTypeRequest, 0x00, 0x08, 0x00}
+	request = binary.LittleEndian.AppendUint32(request, requested)
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	body, err := readTPKT(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	// X.224 Connection Confirm的代码为0xd0
+	if len(body) < 7 || body[1]&0xf0 != 0xd0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected X.224 response")
+	}
+
+	neg := &rdpNegResult{}
+	if len(body) >= 15 {
+		neg.Type = body[7]
+		neg.Flags = body[8]
+		neg.Value = binary.LittleEndian.Uint32(body[11:15])
+	}
+
+	return conn, neg, nil
+}
+
+// rdpCredSSPChallenge 建立TLS后发送携带NTLMSSP Negotiate的TSRequest，读取Challenge
+func (d *OSDetector) rdpCredSSPChallenge(targetIP string) (*NTLMChallengeInfo, string) {
+	conn, neg, err := rdpConnect(targetIP, rdpProtocolSSL|rdpProtocolHybrid)
+	if err != nil {
+		return nil, ""
+	}
+	defer conn.Close()
+	if neg.Type != rdpNegTypeResponse || neg.Value != rdpProtocolHybrid {
+		return nil, ""
+	}
+
+	tlsConn := tls.Client(conn, rdpTLSConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		if d.Verbose {
+			fmt.Printf("[RDP] TLS handshake failed: %v\n", err)
+		}
+		return nil, ""
+	}
+	subject := tlsCertSubject(tlsConn)
+
+	// TSRequest ::= SEQUENCE { version [0] INTEGER, negoTokens [1] SEQUENCE OF SEQUENCE { negoToken [0] OCTET STRING } }
+	tsRequest := berSequence(berTagSequence,
+		berSequence(0xa0, berInteger(berTagInteger, 3)),
+		berSequence(0xa1, berSequence(berTagSequence, berSequence(berTagSequence,
+			berSequence(0xa0, berTLV(berTagOctetString, ntlmNegotiateMessage())),
+		))),
+	)
+	if _, err := tlsConn.Write(tsRequest); err != nil {
+		return nil, subject
+	}
+
+	buffer := make([]byte, 4096)
+	n, err := tlsConn.Read(buffer)
+	if err != nil {
+		return nil, subject
+	}
+
+	challenge, err := parseNTLMChallenge(buffer[:n])
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[RDP] No NTLM challenge: %v\n", err)
+		}
+		return nil, subject
+	}
+
+	return challenge, subject
+}
+
+// readTPKT 读取一个TPKT数据包并返回其负载
+func readTPKT(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x03 {
+		return nil, fmt.Errorf("not a TPKT packet")
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 4 {
+		return nil, fmt.Errorf("invalid TPKT length %d", length)
+	}
+
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// rdpTLSConfig RDP服务通常使用自签名证书，旧版本只支持TLS 1.0
+func rdpTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	}
+}
+
+// tlsCertSubject 返回对端证书的主题
+func tlsCertSubject(conn *tls.Conn) string {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return certs[0].Subject.String()
+}
+
+// supports 检查服务器是否接受指定的安全协议
+func (info *RDPInfo) supports(protocol string) bool {
+	for _, p := range info.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// ScanTarget 待扫描的地址及其名称解析信息和检测结果
+type ScanTarget struct {
+	Input     string   // 命令行给出的目标
+	IP        string   // 实际扫描的地址
+	Hostname  string   // 正向解析使用的主机名，目标为IP地址时为空
+	PTRNames  []string // 反向解析得到的名称
+	Alive     bool
+	Ping      bool
+	OS        string
+	ISN       *ISNAnalysis          // TCP初始序列号分析结果
+	Timestamp *TCPTimestampAnalysis // TCP时间戳时钟频率和运行时间
+	ICMP      *ICMPLegacyResult     // ICMP时间戳、信息请求和地址掩码请求结果
+	Route     *TracerouteResult     // traceroute结果，未启用时为nil
+	Findings  []string              // 安全问题
+
+	// 各服务探测得到的信息，未探测或无响应时为nil
+	NetBIOS    *NetBIOSInfo
+	DNS        *DNSServerInfo
+	NTP        *NTPServerInfo
+	SNMP       *SNMPInfo
+	RDP        *RDPInfo
+	MSRPC      *MSRPCInfo
+	WinRM      *WinRMInfo
+	LDAP       *LDAPRootDSEInfo
+	Kerberos   *KerberosInfo
+	Banners    []*BannerMatch
+	MySQL      *MySQLInfo
+	MSSQL      *MSSQLInfo
+	Redis      *RedisInfo
+	Oracle     *OracleInfo
+	Middleware *MiddlewareInfo
+	SSDP       *SSDPInfo
+	MDNS       *MDNSInfo
+	LLMNR      *LLMNRInfo
+	WSD        *WSDInfo
+}
+
+// CollectServiceInfo 将检测过程中各服务探测得到的信息记录到扫描结果中
+func (d *OSDetector) CollectServiceInfo(t *ScanTarget) {
+	t.NetBIOS = d.netbiosInfo
+	t.DNS = d.dnsInfo
+	t.NTP = d.ntpInfo
+	t.SNMP = d.snmpInfo
+	t.RDP = d.rdpInfo
+	t.MSRPC = d.msrpcInfo
+	t.WinRM = d.winrmInfo
+	t.LDAP = d.ldapInfo
+	t.Kerberos = d.kerberosInfo
+	t.Banners = d.bannerMatches
+	t.MySQL = d.mysqlInfo
+	t.MSSQL = d.mssqlInfo
+	t.Redis = d.redisInfo
+	t.Oracle = d.oracleInfo
+	t.Middleware = d.middlewareInfo
+	t.SSDP = d.ssdpInfo
+	t.MDNS = d.mdnsInfo
+	t.LLMNR = d.llmnrInfo
+	t.WSD = d.wsdInfo
+}
+
+// ResolveTargets 将目标解析为待扫描的地址列表，主机名会展开为全部A/AAAA记录
+func (d *OSDetector) ResolveTargets(target string) ([]*ScanTarget, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		return []*ScanTarget{{Input: target, IP: ip.String()}}, nil
+	}
+	if d.DisableDNS {
+		return nil, fmt.Errorf("目标 %s 不是IP地址且已禁用DNS解析", target)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(MaxRTT*(ResendCount+1))*time.Second)
+	defer cancel()
+	addrs, err := d.resolver().LookupIPAddr(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*ScanTarget
+	seen := make(map[string]bool)
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		targets = append(targets, &ScanTarget{Input: target, IP: ip, Hostname: target})
+	}
+	if d.Verbose {
+		fmt.Printf("[Resolve] %s -> %v\n", target, targets)
+	}
+	log.Printf("目标 %s 解析得到 %d 个地址\n", target, len(targets))
+	return targets, nil
+}
+
+// ReverseLookup 查询地址的PTR记录，禁用DNS或查询失败时返回空
+func (d *OSDetector) ReverseLookup(ip string) []string {
+	if d.DisableDNS {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(MaxRTT*(ResendCount+1))*time.Second)
+	defer cancel()
+	names, err := d.resolver().LookupAddr(ctx, ip)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[Resolve] PTR lookup for %s failed: %v\n", ip, err)
+		}
+		return nil
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSuffix(name, ".")
+	}
+	if d.Verbose {
+		fmt.Printf("[Resolve] %s PTR: %s\n", ip, strings.Join(names, ", "))
+	}
+	return names
+}
+
+// resolver 返回DNS解析器，指定了DNSServer时所有查询都发往该服务器
+func (d *OSDetector) resolver() *net.Resolver {
+	if d.DNSServer == "" {
+		return net.DefaultResolver
+	}
+	server := d.DNSServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: time.Duration(MaxRTT) * time.Second}
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// String 返回地址及其名称，例如 "93.184.216.34 (example.com)"
+func (t *ScanTarget) String() string {
+	var names []string
+	if t.Hostname != "" {
+		names = append(names, t.Hostname)
+	}
+	for _, name := range t.PTRNames {
+		if !strings.EqualFold(name, t.Hostname) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return t.IP
+	}
+	return fmt.Sprintf("%s (%s)", t.IP, strings.Join(names, ", "))
+}
@@ -0,0 +1,273 @@
+package detector
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SNMP 相关常量
+const (
+	snmpVersion1  = 0
+	snmpVersion2c = 1
+
+	snmpTagGetRequest  = 0xa0
+	snmpTagGetResponse = 0xa2
+
+	snmpOIDSysDescr    = "1.3.6.1.2.1.1.1.0"
+	snmpOIDSysObjectID = "1.3.6.1.2.1.1.2.0"
+	snmpOIDSysName     = "1.3.6.1.2.1.1.5.0"
+
+	snmpEnterprisePrefix = "1.3.6.1.4.1."
+)
+
+// SNMPInfo SNMP系统信息
+type SNMPInfo struct {
+	Community   string // 成功使用的团体名
+	Version     string // v1 或 v2c
+	SysDescr    string
+	SysObjectID string
+	SysName     string
+	Vendor      string // 根据企业OID识别的厂商
+	OS          string // 根据sysDescr识别的操作系统
+	OSVersion   string // 操作系统版本
+}
+
+// snmpEnterprises 常见企业OID对应的厂商和操作系统
+var snmpEnterprises = map[int]struct {
+	vendor string
+	os     string
+}{
+	9:     {"Cisco", "Cisco IOS"},
+	11:    {"HP", ""},
+	253:   {"Xerox", "Printer"},
+	311:   {"Microsoft", "Windows"},
+	367:   {"Ricoh", "Printer"},
+	641:   {"Lexmark", "Printer"},
+	1347:  {"Kyocera", "Printer"},
+	1602:  {"Canon", "Printer"},
+	2011:  {"Huawei", "VRP"},
+	2021:  {"UCD-SNMP", "Linux"},
+	2435:  {"Brother", "Printer"},
+	2636:  {"Juniper", "JUNOS"},
+	3375:  {"F5", "TMOS"},
+	6876:  {"VMware", "ESXi"},
+	8072:  {"Net-SNMP", ""},
+	12325: {"FreeBSD", "FreeBSD"},
+	12356: {"Fortinet", "FortiOS"},
+	14988: {"MikroTik", "RouterOS"},
+	25461: {"Palo Alto", "PAN-OS"},
+	25506: {"H3C", "Comware"},
+	30065: {"Arista", "EOS"},
+}
+
+// snmpDescrPatterns sysDescr匹配规则，第一个子匹配为版本号
+var snmpDescrPatterns = []struct {
+	pattern *regexp.Regexp
+	os      string
+}{
+	{regexp.MustCompile(`Cisco IOS.*?Version ([^,\s]+)`), "Cisco IOS"},
+	{regexp.MustCompile(`Cisco NX-OS.*?Version ([^,\s]+)`), "Cisco NX-OS"},
+	{regexp.MustCompile(`Cisco Adaptive Security Appliance Version (\S+)`), "Cisco ASA"},
+	{regexp.MustCompile(`JUNOS (\S+)`), "JUNOS"},
+	{regexp.MustCompile(`RouterOS (\S+)`), "RouterOS"},
+	{regexp.MustCompile(`Versatile Routing Platform.*?Version (\S+)`), "VRP"},
+	{regexp.MustCompile(`VMware ESXi (\S+)`), "ESXi"},
+	{regexp.MustCompile(`Windows Version (\d+\.\d+ \(Build \d+\))`), "Windows"},
+	{regexp.MustCompile(`^Linux \S+ (\S+)`), "Linux"},
+	{regexp.MustCompile(`^FreeBSD \S+ (\S+)`), "FreeBSD"},
+	{regexp.MustCompile(`^Darwin \S+ (\S+)`), "Darwin"},
+}
+
+// snmpWindowsVersionPattern 解析Windows sysDescr中的版本号和build号
+var snmpWindowsVersionPattern = regexp.MustCompile(`(\d+)\.(\d+) \(Build (\d+)`)
+
+// SNMPFingerprint 通过SNMP sysDescr和sysObjectID识别操作系统
+func (d *OSDetector) SNMPFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	info, err := d.snmpGetSystem(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[SNMP] No response: %v\n", err)
+		}
+		return resultSet
+	}
+	identifySNMPSystem(info)
+	d.snmpInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[SNMP] Community: %s (%s), sysName: %q, sysObjectID: %s\n", info.Community, info.Version, info.SysName, info.SysObjectID)
+		fmt.Printf("[SNMP] sysDescr: %q\n", info.SysDescr)
+		fmt.Printf("[SNMP] Vendor: %s, OS: %s, Version: %s\n", info.Vendor, info.OS, info.OSVersion)
+	}
+	d.addDetail("SNMP: %s %s %s (%s)", info.Vendor, info.OS, info.OSVersion, info.SysName)
+
+	switch info.OS {
+	case "Cisco IOS":
+		resultSet["Cisco IOS"] = true
+	case "Windows":
+		if m := snmpWindowsVersionPattern.FindStringSubmatch(info.OSVersion); m != nil {
+			major, _ := strconv.Atoi(m[1])
+			minor, _ := strconv.Atoi(m[2])
+			build, _ := strconv.Atoi(m[3])
+			resultSet = windowsOSSetFromVersion(major, minor, build)
+		} else {
+			resultSet = newOSSet(WindowsFamily)
+		}
+	case "Linux":
+		resultSet = osSetFromLinuxKernel(info.OSVersion)
+	case "FreeBSD":
+		resultSet["FreeBSD"] = true
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 4
+	}
+	if len(resultSet) > 0 {
+		log.Println("SNMP系统描述显示目标为:", info.OS, info.OSVersion)
+	}
+
+	return resultSet
+}
+
+// SNMPInfo 返回SNMP系统信息，未探测或无响应时为nil
+func (d *OSDetector) SNMPInfo() *SNMPInfo {
+	return d.snmpInfo
+}
+
+// snmpGetSystem 使用团体名列表并行发送v2c和v1请求，返回第一个有效响应
+func (d *OSDetector) snmpGetSystem(targetIP string) (*SNMPInfo, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(targetIP, "161"), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 错误的团体名不会得到任何响应，因此一次性发出所有请求，避免逐个等待超时
+	requests := make(map[int64]*SNMPInfo)
+	for _, community := range d.SNMPCommunities {
+		for _, version := range []int{snmpVersion2c, snmpVersion1} {
+			requestID := rand.Int63n(0x7fffffff)
+			requests[requestID] = &SNMPInfo{Community: community, Version: snmpVersionName(version)}
+			if _, err := conn.Write(snmpGetRequest(version, community, requestID)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Duration(MaxRTT*(ResendCount+1)) * time.Second))
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		requestID, vars, err := parseSNMPResponse(buffer[:n])
+		if err != nil {
+			continue
+		}
+		info, ok := requests[requestID]
+		if !ok {
+			continue
+		}
+		info.SysDescr = vars[snmpOIDSysDescr]
+		info.SysObjectID = vars[snmpOIDSysObjectID]
+		info.SysName = vars[snmpOIDSysName]
+		return info, nil
+	}
+}
+
+// snmpGetRequest 构造查询sysDescr、sysObjectID和sysName的GetRequest
+func snmpGetRequest(version int, community string, requestID int64) []byte {
+	var varBinds [][]byte
+	for _, oid := range []string{snmpOIDSysDescr, snmpOIDSysObjectID, snmpOIDSysName} {
+		varBinds = append(varBinds, berSequence(berTagSequence, berOID(oid), berTLV(berTagNull, nil)))
+	}
+
+	pdu := berSequence(snmpTagGetRequest,
+		berInteger(berTagInteger, requestID),
+		berInteger(berTagInteger, 0), // error-status
+		berInteger(berTagInteger, 0), // error-index
+		berSequence(berTagSequence, varBinds...),
+	)
+
+	return berSequence(berTagSequence,
+		berInteger(berTagInteger, int64(version)),
+		berTLV(berTagOctetString, []byte(community)),
+		pdu,
+	)
+}
+
+// parseSNMPResponse 解析GetResponse，返回请求ID和变量绑定
+func parseSNMPResponse(data []byte) (int64, map[string]string, error) {
+	msg, _, err := parseBER(data)
+	if err != nil || msg.Tag != berTagSequence {
+		return 0, nil, fmt.Errorf("invalid SNMP message")
+	}
+	fields, err := msg.children()
+	if err != nil || len(fields) < 3 || fields[2].Tag != snmpTagGetResponse {
+		return 0, nil, fmt.Errorf("not an SNMP response")
+	}
+
+	pdu, err := fields[2].children()
+	if err != nil || len(pdu) < 4 {
+		return 0, nil, fmt.Errorf("invalid SNMP PDU")
+	}
+	if pdu[1].int() != 0 {
+		return 0, nil, fmt.Errorf("SNMP error-status %d", pdu[1].int())
+	}
+
+	vars := make(map[string]string)
+	varBinds, _ := pdu[3].children()
+	for _, varBind := range varBinds {
+		pair, err := varBind.children()
+		if err != nil || len(pair) < 2 {
+			continue
+		}
+		switch pair[1].Tag {
+		case berTagOctetString:
+			vars[pair[0].oid()] = strings.TrimSpace(string(pair[1].Value))
+		case berTagOID:
+			vars[pair[0].oid()] = pair[1].oid()
+		}
+	}
+
+	return pdu[0].int(), vars, nil
+}
+
+// identifySNMPSystem 根据企业OID和sysDescr识别厂商、操作系统和版本
+func identifySNMPSystem(info *SNMPInfo) {
+	if strings.HasPrefix(info.SysObjectID, snmpEnterprisePrefix) {
+		arcs := strings.SplitN(strings.TrimPrefix(info.SysObjectID, snmpEnterprisePrefix), ".", 2)
+		if enterprise, err := strconv.Atoi(arcs[0]); err == nil {
+			if e, ok := snmpEnterprises[enterprise]; ok {
+				info.Vendor = e.vendor
+				info.OS = e.os
+			} else {
+				info.Vendor = fmt.Sprintf("enterprise %d", enterprise)
+			}
+		}
+	}
+
+	// sysDescr比企业OID更具体，例如Net-SNMP代理可以运行在任何系统上
+	for _, p := range snmpDescrPatterns {
+		if m := p.pattern.FindStringSubmatch(info.SysDescr); m != nil {
+			info.OS = p.os
+			info.OSVersion = m[1]
+			return
+		}
+	}
+}
+
+// snmpVersionName 返回SNMP版本名称
+func snmpVersionName(version int) string {
+	if version == snmpVersion1 {
+		return "v1"
+	}
+	return "v2c"
+}
@@ -0,0 +1,184 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ssdpSearchRequest 单播发送给目标的M-SEARCH请求
+const ssdpSearchRequest = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 1\r\n" +
+	"ST: upnp:rootdevice\r\n\r\n"
+
+// upnpServerOSPattern SERVER头部中的操作系统部分，例如 "Linux/3.14 UPnP/1.0 MiniUPnPd/2.1"
+var upnpServerOSPattern = regexp.MustCompile(`^([A-Za-z][\w.\-]*)/([\w.\-]+)`)
+
+// SSDPInfo UPnP设备信息
+type SSDPInfo struct {
+	Server       string
+	Location     string
+	USN          string
+	DeviceType   string
+	FriendlyName string
+	Manufacturer string
+	ModelName    string
+	ModelNumber  string
+	IsPrinter    bool
+}
+
+// upnpDescription 设备描述XML中关心的字段
+type upnpDescription struct {
+	Device struct {
+		DeviceType   string `xml:"deviceType"`
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+		ModelNumber  string `xml:"modelNumber"`
+	} `xml:"device"`
+}
+
+// SSDPFingerprint 通过UPnP SSDP响应和设备描述识别嵌入式设备和操作系统
+func (d *OSDetector) SSDPFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	response, err := udpExchange(targetIP, 1900, []byte(ssdpSearchRequest))
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[SSDP] No response: %v\n", err)
+		}
+		return resultSet
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), nil)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[SSDP] Invalid response: %v\n", err)
+		}
+		return resultSet
+	}
+	resp.Body.Close()
+
+	info := &SSDPInfo{
+		Server:   resp.Header.Get("Server"),
+		Location: resp.Header.Get("Location"),
+		USN:      resp.Header.Get("USN"),
+	}
+	if err := info.fetchDescription(targetIP); err != nil && d.Verbose {
+		fmt.Printf("[SSDP] Failed to fetch device description: %v\n", err)
+	}
+	info.IsPrinter = containsIgnoreCase(info.DeviceType, ":Printer:")
+	d.ssdpInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[SSDP] Server: %q, Location: %s\n", info.Server, info.Location)
+		fmt.Printf("[SSDP] Device: %s, Name: %q, Model: %s %s %s\n",
+			info.DeviceType, info.FriendlyName, info.Manufacturer, info.ModelName, info.ModelNumber)
+	}
+	d.addDetail("SSDP: %s, %s %s %s", info.Server, info.Manufacturer, info.ModelName, info.ModelNumber)
+	if info.IsPrinter {
+		log.Println("UPnP设备类型显示目标为打印机:", info.Manufacturer, info.ModelName)
+	}
+
+	resultSet = osSetFromUPnPServer(info.Server)
+	for os := range resultSet {
+		d.osWeights[os] += 2
+	}
+	// 嵌入式设备通常运行未标明发行版的Linux
+	if len(resultSet) == len(LinuxFamily) && resultSet["Linux"] {
+		d.osWeights["Linux"] += 2
+	}
+	if len(resultSet) > 0 {
+		log.Println("SSDP SERVER头部显示目标系统为:", info.Server)
+	}
+
+	return resultSet
+}
+
+// SSDPInfo 返回UPnP设备信息，未探测或无响应时为nil
+func (d *OSDetector) SSDPInfo() *SSDPInfo {
+	return d.ssdpInfo
+}
+
+// fetchDescription 获取LOCATION指向的设备描述XML，只访问目标主机
+func (info *SSDPInfo) fetchDescription(targetIP string) error {
+	if info.Location == "" {
+		return fmt.Errorf("no LOCATION header")
+	}
+	location, err := url.Parse(info.Location)
+	if err != nil {
+		return err
+	}
+	if location.Hostname() != targetIP {
+		return fmt.Errorf("LOCATION points to another host %s", location.Host)
+	}
+
+	client := &http.Client{Timeout: time.Duration(MaxRTT*(ResendCount+1)) * time.Second}
+	resp, err := client.Get(info.Location)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if info.Server == "" {
+		info.Server = resp.Header.Get("Server")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if err != nil {
+		return err
+	}
+	var desc upnpDescription
+	if err := xml.Unmarshal(body, &desc); err != nil {
+		return err
+	}
+	info.DeviceType = desc.Device.DeviceType
+	info.FriendlyName = desc.Device.FriendlyName
+	info.Manufacturer = desc.Device.Manufacturer
+	info.ModelName = desc.Device.ModelName
+	info.ModelNumber = desc.Device.ModelNumber
+	return nil
+}
+
+// osSetFromUPnPServer 根据SERVER头部的 "OS/版本" 部分推断操作系统
+// 例如 "Linux/2.6.36, UPnP/1.0, Portable SDK for UPnP devices/1.6.6"、"Microsoft-Windows/10.0 UPnP/1.0"
+func osSetFromUPnPServer(server string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	m := upnpServerOSPattern.FindStringSubmatch(server)
+	if m == nil {
+		return resultSet
+	}
+	name, version := strings.ToLower(m[1]), m[2]
+
+	switch {
+	case strings.HasPrefix(name, "linux"):
+		resultSet = osSetFromLinuxKernel(version)
+	case strings.HasPrefix(name, "freebsd"):
+		resultSet["FreeBSD"] = true
+	case strings.HasPrefix(name, "darwin") || strings.HasPrefix(name, "macos") || strings.HasPrefix(name, "mac_os"):
+		resultSet = newOSSet(AppleFamily)
+	case strings.HasPrefix(name, "ios"):
+		resultSet["iOS"] = true
+	case strings.Contains(name, "windows"):
+		// 例如 "Microsoft-Windows-NT/5.1"、"Microsoft-Windows/6.3"，只有主次版本号
+		major, minor := 0, 0
+		fmt.Sscanf(version, "%d.%d", &major, &minor)
+		if major == 10 {
+			// Windows 10/11和Server 2016之后的版本都报告10.0
+			resultSet = newOSSet([]string{"Windows 10", "Windows 11"}, WindowsServerFamily[3:])
+		} else {
+			resultSet = windowsOSSetFromVersion(major, minor, 0)
+		}
+	}
+
+	return resultSet
+}
@@ -0,0 +1,238 @@
+package detector
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"math/rand"
+	"strings"
+
+	"golang.org/x/net/ipv4"
+)
+
+// tcpTest nmap T2-T7风格的探测定义
+type tcpTest struct {
+	Name   string
+	Closed bool // 是否发往关闭端口
+	tcpProbe
+}
+
+// tcpTests 发往开放端口的NULL、SYN|FIN|URG|PSH和ACK，以及发往关闭端口的SYN、ACK和FIN|PSH|URG
+var tcpTests = []tcpTest{
+	{Name: "T2", tcpProbe: tcpProbe{Flags: 0, Window: 128, DF: true}},
+	{Name: "T3", tcpProbe: tcpProbe{Flags: tcpSYN | tcpFIN | tcpURG | tcpPSH, Window: 256}},
+	{Name: "T4", tcpProbe: tcpProbe{Flags: tcpACK, Window: 1024, DF: true}},
+	{Name: "T5", Closed: true, tcpProbe: tcpProbe{Flags: tcpSYN, Window: 31337}},
+	{Name: "T6", Closed: true, tcpProbe: tcpProbe{Flags: tcpACK, Window: 32768, DF: true}},
+	{Name: "T7", Closed: true, tcpProbe: tcpProbe{Flags: tcpFIN | tcpPSH | tcpURG, Window: 65535}},
+}
+
+// tcpTestOptions T2-T6使用的TCP选项，T7的窗口缩放值为15
+var tcpTestOptions = []byte{3, 3, 10, 1, 2, 4, 1, 9, 8, 10, 255, 255, 255, 255, 0, 0, 0, 0, 4, 2}
+
+// TCPTestResult 单个探测的响应特征，字段含义与nmap T测试一致
+type TCPTestResult struct {
+	Name      string
+	Closed    bool // 是否发往关闭端口
+	Responded bool
+	DF        bool
+	TTL       int
+	Window    int
+	S         string // 响应序列号与探测确认号的关系：Z、A、A+、O
+	A         string // 响应确认号与探测序列号的关系：Z、S、S+、O
+	Flags     string // 响应标志，按E U A P R S F顺序
+	Options   string // TCP选项签名
+	RD        uint32 // RST载荷的CRC32，无载荷时为0
+	Quirks    string // R表示保留位非0，U表示未设置URG时紧急指针非0
+
+	response *tcpResponse
+}
+
+// TCPTestsFingerprint 分析开放端口和关闭端口对异常标志组合的响应，没有开放端口时也能从RST中获得证据
+func (d *OSDetector) TCPTestsFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	results := d.collectTCPTests(targetIP)
+	if len(results) == 0 {
+		return resultSet
+	}
+	byName := make(map[string]*TCPTestResult)
+	var summary []string
+	for _, r := range results {
+		byName[r.Name] = r
+		summary = append(summary, r.String())
+		if d.Verbose {
+			fmt.Printf("[TCP Tests] %s\n", r)
+		}
+	}
+	d.addDetail("TCP tests: %s", strings.Join(summary, " "))
+
+	responded := func(name string) bool {
+		r, ok := byName[name]
+		return ok && r.Responded
+	}
+
+	// Linux、BSD和Apple系统丢弃发往开放端口的无标志报文，Windows回复RST
+	if responded("T2") && byName["T2"].Flags == "AR" {
+		resultSet = newOSSet(WindowsFamily, EmbeddedFamily)
+		for _, os := range WindowsFamily {
+			d.osWeights[os] += 4
+		}
+		log.Println("开放端口对无标志报文回复RST，可能是Windows系统")
+	}
+
+	// Windows回复ACK报文的RST中确认号不为0，Linux和BSD为0
+	for _, name := range []string{"T4", "T6"} {
+		if !responded(name) {
+			continue
+		}
+		switch byName[name].A {
+		case "O":
+			for _, os := range WindowsFamily {
+				d.osWeights[os] += 2
+			}
+		case "Z":
+			for _, os := range LinuxFamily {
+				d.osWeights[os]++
+			}
+			d.osWeights["FreeBSD"]++
+		}
+	}
+
+	// BSD系协议栈接受带FIN的SYN并回复SYN/ACK
+	if responded("T3") && strings.Contains(byName["T3"].Flags, "S") {
+		for _, os := range BSDFamily {
+			d.osWeights[os] += 3
+		}
+		log.Println("开放端口对SYN|FIN|URG|PSH回复SYN/ACK，可能是BSD或Apple系统")
+	}
+
+	// Linux和Windows的RST设置DF，Apple和部分BSD不设置
+	if responded("T5") && !byName["T5"].DF {
+		for _, os := range BSDFamily {
+			d.osWeights[os] += 2
+		}
+	}
+
+	// 在RST中附带说明文字的通常是网络设备和打印机
+	for _, r := range results {
+		if r.RD != 0 {
+			d.osWeights["Cisco IOS"] += 2
+			log.Printf("%s的RST响应携带数据载荷\n", r.Name)
+			break
+		}
+	}
+
+	return resultSet
+}
+
+// collectTCPTests 发送T2-T7探测，没有开放端口时只发送关闭端口的探测
+func (d *OSDetector) collectTCPTests(targetIP string) []*TCPTestResult {
+	if d.tcpTestsCollected {
+		return d.tcpTestResults
+	}
+	d.tcpTestsCollected = true
+
+	session, err := newRawTCPSession(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[TCP Tests] Failed to open raw socket: %v\n", err)
+		}
+		return nil
+	}
+	defer session.Close()
+
+	closedPort := 40000 + rand.Intn(20000)
+	for _, test := range tcpTests {
+		p := test.tcpProbe
+		p.DstPort = d.lastCheckedPort
+		if test.Closed {
+			p.DstPort = closedPort
+		}
+		if p.DstPort == 0 {
+			continue
+		}
+		p.Seq = rand.Uint32()
+		p.Ack = rand.Uint32()
+		p.Options = tcpTestOptions
+		if test.Name == "T7" {
+			p.Options = append([]byte{3, 3, 15}, tcpTestOptions[3:]...)
+		}
+
+		// 开放端口的T2、T3在很多系统上没有响应，只重发一次以免拖慢检测
+		result := &TCPTestResult{Name: test.Name, Closed: test.Closed}
+		if resp, err := session.exchange(&p, 1); err == nil {
+			result.analyze(&p, resp)
+		}
+		d.tcpTestResults = append(d.tcpTestResults, result)
+	}
+	return d.tcpTestResults
+}
+
+// analyze 按nmap的规则记录响应特征
+func (r *TCPTestResult) analyze(p *tcpProbe, resp *tcpResponse) {
+	r.response = resp
+	r.Responded = true
+	r.DF = resp.IP.Flags&ipv4.DontFragment != 0
+	r.TTL = resp.IP.TTL
+	r.Window = resp.Window
+	r.Options = tcpOptionSignature(resp.Options)
+
+	switch resp.Seq {
+	case 0:
+		r.S = "Z"
+	case p.Ack:
+		r.S = "A"
+	case p.Ack + 1:
+		r.S = "A+"
+	default:
+		r.S = "O"
+	}
+	switch resp.Ack {
+	case 0:
+		r.A = "Z"
+	case p.Seq:
+		r.A = "S"
+	case p.Seq + 1:
+		r.A = "S+"
+	default:
+		r.A = "O"
+	}
+
+	for _, flag := range []struct {
+		bit  int
+		name string
+	}{{tcpECE, "E"}, {tcpURG, "U"}, {tcpACK, "A"}, {tcpPSH, "P"}, {tcpRST, "R"}, {tcpSYN, "S"}, {tcpFIN, "F"}} {
+		if resp.Flags&flag.bit != 0 {
+			r.Flags += flag.name
+		}
+	}
+
+	if resp.Flags&tcpRST != 0 && len(resp.Payload) > 0 {
+		r.RD = crc32.ChecksumIEEE(resp.Payload)
+	}
+	if resp.Reserved != 0 {
+		r.Quirks += "R"
+	}
+	if resp.Urgent != 0 && resp.Flags&tcpURG == 0 {
+		r.Quirks += "U"
+	}
+}
+
+// String 返回nmap格式的测试结果，例如 "T5(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD=0%Q=)"
+func (r *TCPTestResult) String() string {
+	if !r.Responded {
+		return r.Name + "(R=N)"
+	}
+	df := "N"
+	if r.DF {
+		df = "Y"
+	}
+	return fmt.Sprintf("%s(R=Y%%DF=%s%%T=%X%%W=%X%%S=%s%%A=%s%%F=%s%%O=%s%%RD=%X%%Q=%s)",
+		r.Name, df, r.TTL, r.Window, r.S, r.A, r.Flags, r.Options, r.RD, r.Quirks)
+}
+
+// TCPTestResults 返回T2-T7探测结果，未探测时为nil
+func (d *OSDetector) TCPTestResults() []*TCPTestResult {
+	return d.tcpTestResults
+}
@@ -0,0 +1,67 @@
+package detector
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+func TestTCPTestResultAnalyze(t *testing.T) {
+	const seq, ack = 0x1000, 0x2000
+	banner := []byte("Connection refused")
+
+	tests := []struct {
+		name  string
+		probe tcpProbe
+		resp  *tcpResponse
+		want  string
+	}{
+		{
+			// Linux对关闭端口的SYN回复RST|ACK，确认号为探测序列号加1
+			name:  "T5",
+			probe: tcpProbe{Flags: tcpSYN},
+			resp:  &tcpResponse{IP: &ipv4.Header{Flags: ipv4.DontFragment, TTL: 64}, Ack: seq + 1, Flags: tcpRST | tcpACK},
+			want:  "T5(R=Y%DF=Y%T=40%W=0%S=Z%A=S+%F=AR%O=%RD=0%Q=)",
+		},
+		{
+			// Windows对ACK回复的RST使用探测确认号作为序列号，确认号不为0
+			name:  "T4",
+			probe: tcpProbe{Flags: tcpACK},
+			resp:  &tcpResponse{IP: &ipv4.Header{TTL: 128}, Seq: ack, Ack: 0x3000, Flags: tcpRST},
+			want:  "T4(R=Y%DF=N%T=80%W=0%S=A%A=O%F=R%O=%RD=0%Q=)",
+		},
+		{
+			// BSD接受带FIN的SYN并回复带ECE的SYN/ACK
+			name:  "T3",
+			probe: tcpProbe{Flags: tcpSYN | tcpFIN | tcpURG | tcpPSH},
+			resp: &tcpResponse{IP: &ipv4.Header{Flags: ipv4.DontFragment, TTL: 64}, Seq: 0xdeadbeef, Ack: seq + 1,
+				Flags: tcpECE | tcpSYN | tcpACK, Window: 0xffff, Options: []byte{2, 4, 5, 180}},
+			want: "T3(R=Y%DF=Y%T=40%W=FFFF%S=O%A=S+%F=EAS%O=M5B4%RD=0%Q=)",
+		},
+		{
+			// 网络设备在RST中附带文字，保留位和紧急指针也可能不为0
+			name:  "T7",
+			probe: tcpProbe{Flags: tcpFIN | tcpPSH | tcpURG},
+			resp: &tcpResponse{IP: &ipv4.Header{TTL: 255}, Seq: ack + 1, Ack: seq, Flags: tcpRST | tcpACK,
+				Reserved: 1, Urgent: 5, Payload: banner},
+			want: fmt.Sprintf("T7(R=Y%%DF=N%%T=FF%%W=0%%S=A+%%A=S%%F=AR%%O=%%RD=%X%%Q=RU)", crc32.ChecksumIEEE(banner)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.probe.Seq, tt.probe.Ack = seq, ack
+			r := &TCPTestResult{Name: tt.name}
+			r.analyze(&tt.probe, tt.resp)
+			if got := r.String(); got != tt.want {
+				t.Errorf("analyze() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&TCPTestResult{Name: "T2"}).String(); got != "T2(R=N)" {
+		t.Errorf("String() = %s, want T2(R=N)", got)
+	}
+}
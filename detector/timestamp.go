@@ -0,0 +1,174 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+)
+
+// TCPTimestampAnalysis SYN/ACK时间戳选项分析结果
+type TCPTimestampAnalysis struct {
+	Supported bool          // SYN/ACK是否携带时间戳选项
+	TSvals    []uint32      // 各响应的TSval
+	Hz        int           // 时钟频率，0表示TSval为0或无法计算
+	Random    bool          // 每个连接使用随机的TSval偏移
+	TS        string        // nmap TS测试值，例如 "A" 表示1000Hz
+	Uptime    time.Duration // 根据TSval/Hz估算的运行时间
+	// Linux 4.10之后每个目的地址的TSval带有随机偏移，目标可能是Linux时运行时间不可靠
+	UptimeUnreliable bool
+}
+
+// TCPTimestampFingerprint 根据多个SYN/ACK的TSval计算远端时间戳时钟频率并估算运行时间
+func (d *OSDetector) TCPTimestampFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	responses := d.collectSEQResponses(targetIP)
+	if len(responses) < 2 {
+		return resultSet
+	}
+	analysis := analyzeTCPTimestamps(responses)
+	d.timestampAnalysis = analysis
+
+	analysis.UptimeUnreliable = analysis.Hz > 0 && d.likelyLinuxStack(responses)
+
+	if d.Verbose {
+		fmt.Printf("[TCP Timestamp] Supported: %v, TSvals: %v, Hz: %d, Random: %v, TS=%s, Uptime: %s (unreliable: %v)\n",
+			analysis.Supported, analysis.TSvals, analysis.Hz, analysis.Random, analysis.TS, analysis.Uptime, analysis.UptimeUnreliable)
+	}
+	d.addDetail("TCP timestamp: TS=%s, %d Hz, uptime %s", analysis.TS, analysis.Hz, analysis.Uptime)
+
+	switch {
+	case analysis.Random:
+		// FreeBSD和部分Linux内核按连接随机化TSval偏移，无法计算时钟频率和运行时间
+		d.osWeights["FreeBSD"] += 2
+		for _, os := range LinuxFamily {
+			d.osWeights[os]++
+		}
+		log.Println("SYN/ACK的TSval按连接随机化，无法估算运行时间")
+	case !analysis.Supported:
+		// 主流系统在对端请求时都会返回时间戳，缺少时间戳选项没有区分度
+		log.Println("SYN/ACK未携带时间戳选项")
+	case analysis.TS == "0":
+		// Windows XP/2003在首个SYN/ACK中回复TSval为0
+		d.osWeights["Windows XP"] += 3
+		d.osWeights["Windows Server 2003"] += 3
+		log.Println("SYN/ACK的TSval为0，可能是Windows XP/2003")
+	case analysis.Hz == 100:
+		// Windows 7/8/2008/2012和老版本Linux、FreeBSD使用100Hz时钟
+		for _, os := range []string{"Windows 7", "Windows 8", "Windows Server 2008", "Windows Server 2012"} {
+			d.osWeights[os] += 3
+		}
+		d.osWeights["FreeBSD"]++
+		log.Println("TCP时间戳时钟频率为100Hz，可能是Windows 7/8或Server 2008/2012")
+	case analysis.Hz == 1000:
+		// Linux 4.13之后固定使用毫秒时钟，macOS、FreeBSD和Windows 10之后也为1000Hz
+		for _, os := range LinuxFamily {
+			d.osWeights[os] += 2
+		}
+		for _, os := range []string{"FreeBSD", "macOS", "iOS", "Windows 10", "Windows 11"} {
+			d.osWeights[os]++
+		}
+		log.Println("TCP时间戳时钟频率为1000Hz")
+	case analysis.Hz == 2:
+		// 2Hz时钟只出现在老版本BSD和嵌入式系统上
+		d.osWeights["FreeBSD"] += 2
+		d.osWeights["Palm OS"]++
+	}
+
+	return resultSet
+}
+
+// TCPTimestampAnalysis 返回时间戳分析结果，未分析时为nil
+func (d *OSDetector) TCPTimestampAnalysis() *TCPTimestampAnalysis {
+	return d.timestampAnalysis
+}
+
+// likelyLinuxStack 根据SYN/ACK选项签名和IP ID判断目标是否可能是Linux
+func (d *OSDetector) likelyLinuxStack(responses []*tcpResponse) bool {
+	if d.ipidAnalysis != nil && d.ipidAnalysis.TI == IPIDZero {
+		return true
+	}
+	for os := range matchTCPFeatures(responses[0].Options, OSDB) {
+		if slices.Contains(LinuxFamily, os) {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeTCPTimestamps 按nmap TS测试的方法计算相邻响应的平均TSval增长速率
+func analyzeTCPTimestamps(responses []*tcpResponse) *TCPTimestampAnalysis {
+	analysis := &TCPTimestampAnalysis{TS: "U"}
+
+	var rates []float64
+	var prev *tcpResponse
+	var prevTSval uint32
+	for _, resp := range responses {
+		option := findTCPOption(resp.Options, 8)
+		if len(option) != 8 {
+			continue
+		}
+		analysis.Supported = true
+		tsval := binary.BigEndian.Uint32(option[0:4])
+		analysis.TSvals = append(analysis.TSvals, tsval)
+		if prev != nil {
+			if elapsed := resp.Sent.Sub(prev.Sent).Seconds(); elapsed > 0 {
+				rates = append(rates, float64(tsval-prevTSval)/elapsed)
+			}
+		}
+		prev, prevTSval = resp, tsval
+	}
+	if !analysis.Supported {
+		return analysis
+	}
+
+	zero := true
+	for _, tsval := range analysis.TSvals {
+		if tsval != 0 {
+			zero = false
+		}
+	}
+	if zero {
+		analysis.TS = "0"
+		return analysis
+	}
+	if len(rates) == 0 {
+		analysis.TS = ""
+		return analysis
+	}
+
+	var sum float64
+	for _, rate := range rates {
+		sum += rate
+	}
+	avg := sum / float64(len(rates))
+	switch {
+	case avg > 1<<16:
+		// 远超任何实际时钟频率，说明TSval按连接随机偏移
+		analysis.TS = fmt.Sprintf("%X", int(math.Round(math.Log2(avg))))
+		analysis.Random = true
+		return analysis
+	case avg <= 5.66:
+		analysis.TS, analysis.Hz = "1", 2
+	case avg >= 70 && avg <= 150:
+		analysis.TS, analysis.Hz = "7", 100
+	case avg >= 150 && avg <= 350:
+		analysis.TS, analysis.Hz = "8", 200
+	default:
+		// 其他频率取 log2 后四舍五入，1000Hz对应 "A"
+		exp := int(math.Round(math.Log2(avg)))
+		analysis.TS, analysis.Hz = fmt.Sprintf("%X", exp), 1<<exp
+		if exp == 10 {
+			analysis.Hz = 1000
+		}
+	}
+
+	// TSval从启动时的0开始计数，Linux 4.10之后每个目的地址有随机偏移，此时只是估计值
+	last := analysis.TSvals[len(analysis.TSvals)-1]
+	analysis.Uptime = time.Duration(float64(last)/float64(analysis.Hz)) * time.Second
+
+	return analysis
+}
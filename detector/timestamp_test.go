@@ -0,0 +1,139 @@
+package detector
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// linuxSYNACKOptions Linux对SEQ第一个探测回复的选项，签名为 "M5B4ST11NW7"
+func linuxSYNACKOptions(tsval uint32) []byte {
+	options := []byte{2, 4, 5, 180, 4, 2, 8, 10}
+	options = binary.BigEndian.AppendUint32(options, tsval)
+	options = binary.BigEndian.AppendUint32(options, 0xffffffff)
+	return append(options, 1, 3, 3, 7)
+}
+
+// windowsSYNACKOptions Windows 7之后的系统不带时间戳时回复的选项，签名为 "M5B4NW8NNS"
+var windowsSYNACKOptions = []byte{2, 4, 5, 180, 1, 3, 3, 8, 1, 1, 4, 2}
+
+// timestampTestResponses 按SEQ探测的100ms间隔构造携带指定TSval的SYN/ACK
+func timestampTestResponses(tsvals ...uint32) []*tcpResponse {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var responses []*tcpResponse
+	for i, tsval := range tsvals {
+		responses = append(responses, &tcpResponse{Options: linuxSYNACKOptions(tsval), Sent: start.Add(time.Duration(i) * seqProbeInterval)})
+	}
+	return responses
+}
+
+func TestAnalyzeTCPTimestamps(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []*tcpResponse
+		supported bool
+		ts        string
+		hz        int
+		random    bool
+		uptime    time.Duration
+	}{
+		{
+			// Linux 4.13之后的毫秒时钟，nmap TS=A
+			name:      "1000 Hz",
+			responses: timestampTestResponses(86400000, 86400100, 86400200, 86400300, 86400400, 86400500),
+			supported: true,
+			ts:        "A",
+			hz:        1000,
+			uptime:    86400 * time.Second,
+		},
+		{
+			// Windows 7/2008的100Hz时钟，nmap TS=7
+			name:      "100 Hz",
+			responses: timestampTestResponses(360000, 360010, 360020, 360030, 360040, 360050),
+			supported: true,
+			ts:        "7",
+			hz:        100,
+			uptime:    time.Hour,
+		},
+		{
+			name:      "200 Hz",
+			responses: timestampTestResponses(720000, 720020, 720040, 720060, 720080, 720100),
+			supported: true,
+			ts:        "8",
+			hz:        200,
+			uptime:    time.Hour,
+		},
+		{
+			// 老版本BSD的2Hz时钟，100ms间隔内TSval大多不变
+			name:      "2 Hz",
+			responses: timestampTestResponses(7198, 7198, 7199, 7199, 7200, 7200),
+			supported: true,
+			ts:        "1",
+			hz:        2,
+			uptime:    time.Hour,
+		},
+		{
+			// Windows XP/2003回复TSval为0，nmap TS=0
+			name:      "zero",
+			responses: timestampTestResponses(0, 0, 0, 0, 0, 0),
+			supported: true,
+			ts:        "0",
+		},
+		{
+			// 按连接随机化的TSval偏移
+			name:      "random offsets",
+			responses: timestampTestResponses(0x1a2b3c4d, 0x9f8e7d6c, 0x0badf00d, 0x7e57c0de, 0xdeadbeef, 0x31415926),
+			supported: true,
+			ts:        "22",
+			random:    true,
+		},
+		{
+			name:      "single response",
+			responses: timestampTestResponses(86400000),
+			supported: true,
+			ts:        "",
+		},
+		{
+			name:      "no timestamp option",
+			responses: []*tcpResponse{{Options: windowsSYNACKOptions}, {Options: windowsSYNACKOptions}},
+			ts:        "U",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := analyzeTCPTimestamps(tt.responses)
+			if analysis.Supported != tt.supported || analysis.TS != tt.ts || analysis.Hz != tt.hz || analysis.Random != tt.random {
+				t.Errorf("analyzeTCPTimestamps() = Supported %v, TS %q, Hz %d, Random %v; want %v, %q, %d, %v",
+					analysis.Supported, analysis.TS, analysis.Hz, analysis.Random, tt.supported, tt.ts, tt.hz, tt.random)
+			}
+			if analysis.Uptime.Truncate(time.Second) != tt.uptime {
+				t.Errorf("Uptime = %s, want %s", analysis.Uptime, tt.uptime)
+			}
+		})
+	}
+}
+
+func TestLikelyLinuxStack(t *testing.T) {
+	tests := []struct {
+		name      string
+		ipid      *IPIDAnalysis
+		responses []*tcpResponse
+		want      bool
+	}{
+		{"Linux options", nil, timestampTestResponses(86400000), true},
+		{"Windows options", nil, []*tcpResponse{{Options: windowsSYNACKOptions}}, false},
+		{"zero IP ID", &IPIDAnalysis{TI: IPIDZero}, []*tcpResponse{{Options: windowsSYNACKOptions}}, true},
+		{"incremental IP ID", &IPIDAnalysis{TI: IPIDIncremental}, []*tcpResponse{{Options: windowsSYNACKOptions}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewOSDetector(false)
+			d.ipidAnalysis = tt.ipid
+			if got := d.likelyLinuxStack(tt.responses); got != tt.want {
+				t.Errorf("likelyLinuxStack() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// traceroute探测方式
+const (
+	TracerouteICMP = "icmp" // ICMP回显请求，目标回复回显应答
+	TracerouteUDP  = "udp"  // 发往高端口的UDP，目标回复端口不可达
+	TracerouteTCP  = "tcp"  // 发往开放端口的SYN，目标回复SYN/ACK或RST
+)
+
+const (
+	maxHopDistance      = 30    // traceroute的最大跳数，也是推断初始TTL时允许的最大距离
+	tracerouteBasePort  = 33434 // UDP traceroute的起始目的端口
+	traceroutePollSlice = 50 * time.Millisecond
+)
+
+// TracerouteHop 单跳的探测结果
+type TracerouteHop struct {
+	TTL  int
+	Addr string // 回复超时或到达报文的地址，没有回复时为空
+	RTT  time.Duration
+}
+
+// TracerouteResult traceroute结果，Distance为到达目标时的TTL，直连主机为1
+type TracerouteResult struct {
+	Method   string
+	Hops     []TracerouteHop
+	Reached  bool
+	Distance int
+}
+
+// tracer 一次traceroute使用的套接字和探测标识
+type tracer struct {
+	method  string
+	icmp    *ipv4.RawConn
+	udp     *ipv4.RawConn
+	tcp     *rawTCPSession
+	src     net.IP
+	dst     net.IP
+	id      int // ICMP回显的ID
+	srcPort int // UDP源端口；TCP源端口为srcPort+TTL
+	dstPort int // TCP目的端口
+}
+
+// Traceroute 以递增的TTL发送探测测量到目标的跳数，结果用于根据观测TTL还原初始TTL
+func (d *OSDetector) Traceroute(targetIP, method string) (*TracerouteResult, error) {
+	dst, src, err := localIPv4For(targetIP)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracer{method: method, src: src, dst: dst, id: rand.Intn(0x10000), srcPort: 32768 + rand.Intn(20000)}
+
+	c, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	if t.icmp, err = ipv4.NewRawConn(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	defer t.icmp.Close()
+
+	switch method {
+	case TracerouteICMP:
+	case TracerouteUDP:
+		c, err := net.ListenPacket("ip4:udp", "0.0.0.0")
+		if err != nil {
+			return nil, err
+		}
+		if t.udp, err = ipv4.NewRawConn(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+		defer t.udp.Close()
+	case TracerouteTCP:
+		if t.dstPort = d.lastCheckedPort; t.dstPort == 0 {
+			if t.dstPort, err = d.findOpenTCPPort(targetIP); err != nil {
+				return nil, fmt.Errorf("TCP traceroute需要开放端口：%v", err)
+			}
+		}
+		if t.tcp, err = newRawTCPSession(targetIP); err != nil {
+			return nil, err
+		}
+		defer t.tcp.Close()
+	default:
+		return nil, fmt.Errorf("不支持的traceroute方式：%s", method)
+	}
+
+	result := &TracerouteResult{Method: method}
+	for ttl := 1; ttl <= maxHopDistance && !result.Reached; ttl++ {
+		hop := TracerouteHop{TTL: ttl}
+		for attempt := 0; attempt <= ResendCount && hop.Addr == ""; attempt++ {
+			sent := time.Now()
+			if err := t.send(ttl); err != nil {
+				return nil, err
+			}
+			addr, reached := t.wait(ttl, sent.Add(time.Duration(MaxRTT)*time.Second))
+			if addr != "" {
+				hop.Addr, hop.RTT = addr, time.Since(sent)
+				result.Reached = reached
+			}
+		}
+		if d.Verbose {
+			fmt.Printf("[Traceroute] %2d  %-15s %s\n", hop.TTL, hop.Addr, hop.RTT.Round(time.Microsecond))
+		}
+		result.Hops = append(result.Hops, hop)
+	}
+	if result.Reached {
+		result.Distance = len(result.Hops)
+		d.hopDistance = result.Distance
+		log.Printf("目标 %s 距离 %d 跳（%s traceroute）\n", targetIP, result.Distance, method)
+	} else {
+		log.Printf("%s traceroute在 %d 跳内未到达目标 %s\n", method, maxHopDistance, targetIP)
+	}
+	d.tracerouteResult = result
+	return result, nil
+}
+
+// TracerouteResult 返回traceroute结果，未执行时为nil
+func (d *OSDetector) TracerouteResult() *TracerouteResult {
+	return d.tracerouteResult
+}
+
+// send 发送指定TTL的探测，TTL编码在ICMP序号、UDP目的端口或TCP源端口中
+func (t *tracer) send(ttl int) error {
+	header := &ipv4.Header{
+		Version: ipv4.Version,
+		Len:     ipv4.HeaderLen,
+		ID:      rand.Intn(0x10000),
+		TTL:     ttl,
+		Src:     t.src,
+		Dst:     t.dst,
+	}
+	var conn *ipv4.RawConn
+	var payload []byte
+	switch t.method {
+	case TracerouteICMP:
+		msg := &icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: t.id, Seq: ttl, Data: make([]byte, 32)}}
+		var err error
+		if payload, err = msg.Marshal(nil); err != nil {
+			return err
+		}
+		conn, header.Protocol = t.icmp, 1
+	case TracerouteUDP:
+		payload = marshalUDPDatagram(t.src, t.dst, t.srcPort, tracerouteBasePort+ttl, make([]byte, 32))
+		conn, header.Protocol = t.udp, 17
+	case TracerouteTCP:
+		p := &tcpProbe{DstPort: t.dstPort, Flags: tcpSYN, Window: 1024, Seq: rand.Uint32(), Options: []byte{2, 4, 5, 180}}
+		payload = marshalTCPSegment(t.src, t.dst, t.srcPort+ttl, p)
+		conn, header.Protocol = t.tcp.conn, 6
+	}
+	header.TotalLen = ipv4.HeaderLen + len(payload)
+	return conn.WriteTo(header, payload, nil)
+}
+
+// wait 等待指定TTL探测的回复，返回回复地址以及是否已到达目标
+func (t *tracer) wait(ttl int, deadline time.Time) (string, bool) {
+	for time.Now().Before(deadline) {
+		slice := deadline
+		if t.tcp != nil {
+			// TCP方式需要同时读取两个套接字，轮流以短超时读取
+			slice = time.Now().Add(traceroutePollSlice)
+			if _, err := t.tcp.receive(t.srcPort+ttl, t.dstPort, slice); err == nil {
+				return t.dst.String(), true
+			}
+			slice = time.Now().Add(traceroutePollSlice)
+		}
+		if addr, reached, ok := t.receiveICMP(ttl, slice); ok {
+			return addr, reached
+		}
+	}
+	return "", false
+}
+
+// receiveICMP 读取与探测对应的超时、不可达或回显应答报文
+func (t *tracer) receiveICMP(ttl int, deadline time.Time) (string, bool, bool) {
+	t.icmp.SetReadDeadline(deadline)
+	buffer := make([]byte, 1500)
+	for {
+		h, payload, _, err := t.icmp.ReadFrom(buffer)
+		if err != nil {
+			return "", false, false
+		}
+		msg, err := icmp.ParseMessage(1, payload)
+		if err != nil {
+			continue
+		}
+		switch msg.Type {
+		case ipv4.ICMPTypeEchoReply:
+			echo, ok := msg.Body.(*icmp.Echo)
+			if t.method == TracerouteICMP && ok && echo.ID == t.id && echo.Seq == ttl && h.Src.Equal(t.dst) {
+				return h.Src.String(), true, true
+			}
+		case ipv4.ICMPTypeTimeExceeded, ipv4.ICMPTypeDestinationUnreachable:
+			if t.quotesProbe(payload, ttl) {
+				// 目标自身回复的不可达（UDP端口不可达）说明已经到达
+				return h.Src.String(), h.Src.Equal(t.dst), true
+			}
+		}
+	}
+}
+
+// quotesProbe 检查ICMP差错报文引用的原始报文是否是指定TTL的探测
+func (t *tracer) quotesProbe(raw []byte, ttl int) bool {
+	if len(raw) < 8+ipv4.HeaderLen {
+		return false
+	}
+	quoted := raw[8:]
+	headerLen := int(quoted[0]&0x0f) * 4
+	if headerLen < ipv4.HeaderLen || len(quoted) < headerLen+8 || !net.IP(quoted[16:20]).Equal(t.dst) {
+		return false
+	}
+	inner := quoted[headerLen:]
+	switch t.method {
+	case TracerouteICMP:
+		return quoted[9] == 1 && inner[0] == byte(ipv4.ICMPTypeEcho) &&
+			int(binary.BigEndian.Uint16(inner[4:6])) == t.id && int(binary.BigEndian.Uint16(inner[6:8])) == ttl
+	case TracerouteUDP:
+		return quoted[9] == 17 && int(binary.BigEndian.Uint16(inner[0:2])) == t.srcPort &&
+			int(binary.BigEndian.Uint16(inner[2:4])) == tracerouteBasePort+ttl
+	case TracerouteTCP:
+		return quoted[9] == 6 && int(binary.BigEndian.Uint16(inner[0:2])) == t.srcPort+ttl &&
+			int(binary.BigEndian.Uint16(inner[2:4])) == t.dstPort
+	}
+	return false
+}
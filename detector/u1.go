@@ -0,0 +1,290 @@
+package detector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// U1探测参数，与nmap一致：IP ID为0x1042，载荷为300个 'C'
+const (
+	u1IPID        = 0x1042
+	u1PayloadSize = 300
+	u1BurstSize   = 8 // 检测ICMP差错限速时连续发送的探测数
+)
+
+// U1Result ICMP端口不可达报文的分析结果，字段含义与nmap U1测试一致
+type U1Result struct {
+	Responded   bool
+	DF          bool   // 差错报文是否设置DF
+	TTL         int    // 差错报文的TTL
+	IPL         int    // 差错报文的IP总长度
+	UN          uint32 // ICMP头部中未使用字段的值
+	RIPL        string // 引用的IP总长度，G表示与发送时一致
+	RID         string // 引用的IP ID，G表示与发送时一致
+	RIPCK       string // 引用的IP校验和：G正确、Z为0、I错误
+	RUCK        string // 引用的UDP校验和，G表示与发送时一致
+	RUD         string // 引用的UDP数据：G完整、I被修改
+	Sent        int    // 限速测试发送的探测数
+	Replies     int    // 限速测试收到的端口不可达数
+	RateLimited bool
+}
+
+// U1Fingerprint 向关闭的UDP端口发送探测，分析端口不可达报文对原始报文的引用方式和限速行为
+func (d *OSDetector) U1Fingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	result, err := u1Probe(targetIP)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[U1] Probe failed: %v\n", err)
+		}
+		return resultSet
+	}
+	d.u1Result = result
+
+	if d.Verbose {
+		fmt.Printf("[U1] %s, rate limit: %d/%d replies\n", result, result.Replies, result.Sent)
+	}
+	d.addDetail("ICMP port unreachable: %s, %d/%d replies", result, result.Replies, result.Sent)
+
+	if !result.Responded {
+		// Windows防火墙默认丢弃发往关闭端口的UDP，不回复端口不可达
+		for _, os := range WindowsFamily {
+			d.osWeights[os]++
+		}
+		return resultSet
+	}
+
+	// Linux和Windows尽可能多地引用原始报文，BSD和Apple只引用IP头部和8字节数据
+	switch {
+	case result.IPL == ipv4.HeaderLen+8+ipv4.HeaderLen+8:
+		for _, os := range BSDFamily {
+			d.osWeights[os] += 3
+		}
+		log.Println("端口不可达报文只引用了原始报文的前8字节数据，可能是BSD或Apple系统")
+	case result.IPL >= ipv4.HeaderLen+8+ipv4.HeaderLen+8+u1PayloadSize:
+		for _, os := range LinuxFamily {
+			d.osWeights[os] += 2
+		}
+		for _, os := range WindowsFamily {
+			d.osWeights[os]++
+		}
+	}
+
+	// Linux默认对每个目的地址的ICMP差错限速，连续探测只有部分得到回复
+	if result.RateLimited {
+		for _, os := range LinuxFamily {
+			d.osWeights[os] += 2
+		}
+		log.Printf("ICMP差错报文被限速（%d/%d），可能是Linux系统\n", result.Replies, result.Sent)
+	}
+
+	// 引用的报文被修改或UN字段非0通常出现在嵌入式协议栈上
+	if result.RIPCK == "I" || result.RUD == "I" || result.UN != 0 {
+		for _, os := range EmbeddedFamily {
+			d.osWeights[os] += 2
+		}
+	}
+
+	return resultSet
+}
+
+// U1Result 返回端口不可达分析结果，未探测时为nil
+func (d *OSDetector) U1Result() *U1Result {
+	return d.u1Result
+}
+
+// u1Probe 发送U1探测并分析回复，随后连续发送多个探测检测限速
+func u1Probe(targetIP string) (*U1Result, error) {
+	l, err := newICMPListener(targetIP)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	c, err := net.ListenPacket("ip4:udp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	udp, err := ipv4.NewRawConn(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	defer udp.Close()
+
+	payload := make([]byte, u1PayloadSize)
+	for i := range payload {
+		payload[i] = 'C'
+	}
+	srcPort := 32768 + rand.Intn(28000)
+	dstPort := 40000 + rand.Intn(20000)
+
+	result := &U1Result{}
+	for attempt := 0; attempt <= ResendCount && !result.Responded; attempt++ {
+		datagram := marshalUDPDatagram(l.src, l.dst, srcPort, dstPort, payload)
+		if err := sendRawUDP(udp, l.src, l.dst, u1IPID, datagram); err != nil {
+			return nil, err
+		}
+		h, _, raw, err := l.receive(time.Now().Add(time.Duration(MaxRTT)*time.Second), portUnreachableMatcher(srcPort, dstPort))
+		if err == nil {
+			result.analyze(h, raw, datagram)
+		}
+	}
+
+	// 限速测试：向不同的关闭端口连续发送探测，统计回复数量
+	result.Sent = u1BurstSize
+	ports := make(map[int]bool)
+	for i := 0; i < u1BurstSize; i++ {
+		port := dstPort + 1 + i
+		ports[port] = true
+		sendRawUDP(udp, l.src, l.dst, rand.Intn(0x10000), marshalUDPDatagram(l.src, l.dst, srcPort, port, payload[:8]))
+	}
+	deadline := time.Now().Add(time.Duration(MaxRTT) * time.Second)
+	for {
+		_, _, _, err := l.receive(deadline, func(m *icmp.Message, raw []byte) bool {
+			port, ok := quotedUDPPorts(m, raw, srcPort)
+			return ok && ports[port]
+		})
+		if err != nil {
+			break
+		}
+		result.Replies++
+	}
+	result.RateLimited = result.Replies > 0 && result.Replies < result.Sent
+
+	return result, nil
+}
+
+// analyze 比较差错报文中引用的原始报文与发送的报文
+func (r *U1Result) analyze(h *ipv4.Header, raw []byte, datagram []byte) {
+	r.Responded = true
+	r.DF = h.Flags&ipv4.DontFragment != 0
+	r.TTL = h.TTL
+	r.IPL = h.TotalLen
+	if r.IPL < ipv4.HeaderLen+len(raw) {
+		// 部分平台的TotalLen不包含头部长度
+		r.IPL = ipv4.HeaderLen + len(raw)
+	}
+	r.UN = binary.BigEndian.Uint32(raw[4:8])
+
+	quoted := raw[8:]
+	if len(quoted) < ipv4.HeaderLen {
+		return
+	}
+	quotedHeaderLen := int(quoted[0]&0x0f) * 4
+	if quotedHeaderLen < ipv4.HeaderLen || len(quoted) < quotedHeaderLen {
+		return
+	}
+
+	r.RIPL = compareGood(int(binary.BigEndian.Uint16(quoted[2:4])), ipv4.HeaderLen+len(datagram))
+	r.RID = compareGood(int(binary.BigEndian.Uint16(quoted[4:6])), u1IPID)
+	switch {
+	case binary.BigEndian.Uint16(quoted[10:12]) == 0:
+		r.RIPCK = "Z"
+	case internetChecksum(quoted[:quotedHeaderLen]) == 0:
+		r.RIPCK = "G"
+	default:
+		r.RIPCK = "I"
+	}
+
+	udp := quoted[quotedHeaderLen:]
+	if len(udp) >= 8 {
+		r.RUCK = compareGood(int(binary.BigEndian.Uint16(udp[6:8])), int(binary.BigEndian.Uint16(datagram[6:8])))
+		r.RUD = "G"
+		for _, b := range udp[8:] {
+			if b != 'C' {
+				r.RUD = "I"
+				break
+			}
+		}
+	}
+}
+
+// String 返回nmap格式的测试结果
+func (r *U1Result) String() string {
+	if !r.Responded {
+		return "U1(R=N)"
+	}
+	df := "N"
+	if r.DF {
+		df = "Y"
+	}
+	return fmt.Sprintf("U1(DF=%s%%T=%X%%IPL=%X%%UN=%X%%RIPL=%s%%RID=%s%%RIPCK=%s%%RUCK=%s%%RUD=%s)",
+		df, r.TTL, r.IPL, r.UN, r.RIPL, r.RID, r.RIPCK, r.RUCK, r.RUD)
+}
+
+// portUnreachableMatcher 匹配引用了指定UDP端口对的端口不可达报文
+func portUnreachableMatcher(srcPort, dstPort int) func(*icmp.Message, []byte) bool {
+	return func(m *icmp.Message, raw []byte) bool {
+		port, ok := quotedUDPPorts(m, raw, srcPort)
+		return ok && port == dstPort
+	}
+}
+
+// quotedUDPPorts 从端口不可达报文引用的UDP头部中取出目的端口，源端口必须与srcPort一致
+func quotedUDPPorts(m *icmp.Message, raw []byte, srcPort int) (int, bool) {
+	if m.Type != ipv4.ICMPTypeDestinationUnreachable || m.Code != 3 || len(raw) < 8+ipv4.HeaderLen {
+		return 0, false
+	}
+	quoted := raw[8:]
+	headerLen := int(quoted[0]&0x0f) * 4
+	if len(quoted) < headerLen+8 || quoted[9] != 17 {
+		return 0, false
+	}
+	if int(binary.BigEndian.Uint16(quoted[headerLen:headerLen+2])) != srcPort {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(quoted[headerLen+2 : headerLen+4])), true
+}
+
+// marshalUDPDatagram 构造带校验和的UDP报文
+func marshalUDPDatagram(src, dst net.IP, srcPort, dstPort int, payload []byte) []byte {
+	datagram := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(datagram[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(datagram[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[8:], payload)
+
+	pseudo := make([]byte, 12, 12+len(datagram))
+	copy(pseudo[0:4], src.To4())
+	copy(pseudo[4:8], dst.To4())
+	pseudo[9] = 17
+	binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(datagram)))
+	checksum := internetChecksum(append(pseudo, datagram...))
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(datagram[6:8], checksum)
+	return datagram
+}
+
+// sendRawUDP 使用指定的IP ID发送UDP报文，不设置DF
+func sendRawUDP(conn *ipv4.RawConn, src, dst net.IP, id int, datagram []byte) error {
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TotalLen: ipv4.HeaderLen + len(datagram),
+		ID:       id,
+		TTL:      64,
+		Protocol: 17,
+		Src:      src,
+		Dst:      dst,
+	}
+	return conn.WriteTo(header, datagram, nil)
+}
+
+// compareGood 值一致时返回G，否则返回实际值的十六进制
+func compareGood(actual, expected int) string {
+	if actual == expected {
+		return "G"
+	}
+	return fmt.Sprintf("%X", actual)
+}
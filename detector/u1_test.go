@@ -0,0 +1,128 @@
+package detector
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// u1TestQuote 构造端口不可达报文：ICMP头部、带正确校验和的引用IP头部和引用的UDP报文
+func u1TestQuote(totalLen, id int, protocol byte, datagram []byte) []byte {
+	quoted := make([]byte, ipv4.HeaderLen)
+	quoted[0] = 0x45
+	binary.BigEndian.PutUint16(quoted[2:4], uint16(totalLen))
+	binary.BigEndian.PutUint16(quoted[4:6], uint16(id))
+	quoted[8] = 64
+	quoted[9] = protocol
+	binary.BigEndian.PutUint16(quoted[10:12], internetChecksum(quoted))
+
+	raw := []byte{3, 3, 0, 0, 0, 0, 0, 0}
+	raw = append(raw, quoted...)
+	return append(raw, datagram...)
+}
+
+func TestU1ResultAnalyze(t *testing.T) {
+	payload := make([]byte, u1PayloadSize)
+	for i := range payload {
+		payload[i] = 'C'
+	}
+	datagram := marshalUDPDatagram(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 50000, payload)
+	quoteLen := ipv4.HeaderLen + len(datagram)
+
+	tests := []struct {
+		name   string
+		header *ipv4.Header
+		raw    func() []byte
+		want   string
+	}{
+		{
+			// Linux完整引用原始报文
+			name:   "full quote",
+			header: &ipv4.Header{TTL: 64, TotalLen: 0x164},
+			raw:    func() []byte { return u1TestQuote(quoteLen, u1IPID, 17, datagram) },
+			want:   "U1(DF=N%T=40%IPL=164%UN=0%RIPL=G%RID=G%RIPCK=G%RUCK=G%RUD=G)",
+		},
+		{
+			// 只引用IP头部和UDP头部，TotalLen不包含头部长度
+			name:   "header only",
+			header: &ipv4.Header{Flags: ipv4.DontFragment, TTL: 128, TotalLen: 36},
+			raw:    func() []byte { return u1TestQuote(quoteLen, u1IPID, 17, datagram[:8]) },
+			want:   "U1(DF=Y%T=80%IPL=38%UN=0%RIPL=G%RID=G%RIPCK=G%RUCK=G%RUD=G)",
+		},
+		{
+			// 引用的IP总长度为主机字节序，IP ID和校验和被改写，UDP数据被截断修改
+			name:   "modified quote",
+			header: &ipv4.Header{TTL: 255, TotalLen: 0x164},
+			raw: func() []byte {
+				raw := u1TestQuote(0x4801, 0x4210, 17, datagram)
+				binary.BigEndian.PutUint16(raw[8+10:8+12], 0)
+				binary.BigEndian.PutUint16(raw[8+ipv4.HeaderLen+6:], 0)
+				binary.BigEndian.PutUint32(raw[4:8], 0x10)
+				raw[len(raw)-1] = 0
+				return raw
+			},
+			want: "U1(DF=N%T=FF%IPL=164%UN=10%RIPL=4801%RID=4210%RIPCK=Z%RUCK=0%RUD=I)",
+		},
+		{
+			name:   "bad checksum",
+			header: &ipv4.Header{TTL: 64, TotalLen: 0x164},
+			raw: func() []byte {
+				raw := u1TestQuote(quoteLen, u1IPID, 17, datagram)
+				raw[8+10] ^= 0xff
+				return raw
+			},
+			want: "U1(DF=N%T=40%IPL=164%UN=0%RIPL=G%RID=G%RIPCK=I%RUCK=G%RUD=G)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &U1Result{}
+			r.analyze(tt.header, tt.raw(), datagram)
+			if got := r.String(); got != tt.want {
+				t.Errorf("analyze() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotedUDPPorts(t *testing.T) {
+	datagram := marshalUDPDatagram(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 50000, nil)
+	unreachable := &icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 3}
+
+	// 引用的IP头部带有4字节选项
+	withOptions := u1TestQuote(28, u1IPID, 17, nil)
+	withOptions[8] = 0x46
+	withOptions = append(withOptions, 1, 1, 1, 0)
+	withOptions = append(withOptions, datagram...)
+
+	tests := []struct {
+		name    string
+		m       *icmp.Message
+		raw     []byte
+		srcPort int
+		port    int
+		ok      bool
+	}{
+		{"port unreachable", unreachable, u1TestQuote(28, u1IPID, 17, datagram), 40000, 50000, true},
+		{"IP options", unreachable, withOptions, 40000, 50000, true},
+		{"other source port", unreachable, u1TestQuote(28, u1IPID, 17, datagram), 40001, 0, false},
+		{"host unreachable", &icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 1}, u1TestQuote(28, u1IPID, 17, datagram), 40000, 0, false},
+		{"echo reply", &icmp.Message{Type: ipv4.ICMPTypeEchoReply}, u1TestQuote(28, u1IPID, 17, datagram), 40000, 0, false},
+		{"TCP quote", unreachable, u1TestQuote(28, u1IPID, 6, datagram), 40000, 0, false},
+		{"truncated UDP header", unreachable, u1TestQuote(28, u1IPID, 17, datagram[:4]), 40000, 0, false},
+		{"truncated IP header", unreachable, u1TestQuote(28, u1IPID, 17, nil)[:20], 40000, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, ok := quotedUDPPorts(tt.m, tt.raw, tt.srcPort)
+			if port != tt.port || ok != tt.ok {
+				t.Errorf("quotedUDPPorts() = %d, %v, want %d, %v", port, ok, tt.port, tt.ok)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package detector
 
 import (
 	"fmt"
-	"math/bits"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/ipv4"
 )
@@ -53,49 +54,48 @@ func (d *OSDetector) getOSSetFromDF(df bool) map[string]bool {
 	return resultSet
 }
 
-// getOSSetFromTTL 根据TTL获取可能的操作系统集合
+// getOSSetFromTTL 根据TTL获取可能的操作系统集合，初始TTL不确定时取所有候选值对应集合的并集
 func (d *OSDetector) getOSSetFromTTL(ttl int) map[string]bool {
 	resultSet := make(map[string]bool)
 
 	// 估算初始TTL
-	nextPowerOf2 := nextPowerOf2(ttl)
+	initialTTLs := d.initialTTLCandidates(ttl)
 
 	// 从数据库中获取匹配的操作系统
-	if osList, ok := OSDB["TTL"][nextPowerOf2]; ok {
-		for _, os := range osList {
+	for _, initial := range initialTTLs {
+		for _, os := range OSDB["TTL"][initial] {
 			resultSet[os] = true
 		}
-	} else {
-		// 特殊处理：根据TTL范围推断操作系统
-		if ttl > 32 && ttl <= 64 {
-			// 可能是Linux/FreeBSD，初始TTL为64
-			resultSet["Linux"] = true
-			resultSet["FreeBSD"] = true
-			resultSet["Centos"] = true
-			resultSet["Ubuntu"] = true
-		} else if ttl > 64 && ttl <= 128 {
-			// 可能是Windows，初始TTL为128
-			resultSet["Windows XP"] = true
-			resultSet["Windows 7"] = true
-			resultSet["Windows 10"] = true
-		} else if ttl > 128 && ttl <= 255 {
-			// 可能是Cisco设备或其他网络设备，初始TTL为255
-			// 或者是Solaris/AIX，初始TTL为254
-			resultSet["Symbian"] = true
-			resultSet["Palm OS"] = true
-			resultSet["Debain"] = true
-		}
 	}
 
 	// 记录日志
 	if d.Verbose {
-		fmt.Printf("[TTL Analysis] TTL=%d, Estimated initial TTL=%d, OS options: %s\n",
-			ttl, nextPowerOf2, d.formatOSSet(resultSet))
+		fmt.Printf("[TTL Analysis] TTL=%d, Hop distance=%d, Estimated initial TTL=%v, OS options: %s\n",
+			ttl, d.hopDistance, initialTTLs, d.formatOSSet(resultSet))
 	}
 
 	return resultSet
 }
 
+// initialTTLCandidates 根据观测TTL推断可能的初始TTL。
+// 已知跳数时初始TTL为观测值加上途经的路由器数，否则返回距离不超过maxHopDistance的所有候选值，
+// 例如观测到58时可能是距离2跳的60或距离6跳的64
+func (d *OSDetector) initialTTLCandidates(ttl int) []int {
+	if d.hopDistance > 0 {
+		ttl += d.hopDistance - 1
+	}
+	var candidates []int
+	for _, initial := range InitialTTLs {
+		if initial < ttl {
+			continue
+		}
+		if len(candidates) == 0 || (d.hopDistance == 0 && initial-ttl <= maxHopDistance) {
+			candidates = append(candidates, initial)
+		}
+	}
+	return candidates
+}
+
 // intersectOSSets 计算两个操作系统集合的交集
 func (d *OSDetector) intersectOSSets(set1, set2 map[string]bool) map[string]bool {
 	result := make(map[string]bool)
@@ -116,14 +116,6 @@ func (d *OSDetector) formatOSSet(osSet map[string]bool) string {
 	return strings.Join(osList, ", ")
 }
 
-// nextPowerOf2 计算大于给定数字的最小2的幂次
-func nextPowerOf2(n int) int {
-	if n <= 0 {
-		return 1
-	}
-	return 1 << (bits.Len(uint(n - 1)))
-}
-
 // isLocalIP 检查IP是否是本地网络
 func isLocalIP(ip string) bool {
 	// 检查是否是本地网络IP
@@ -159,3 +151,129 @@ func isLikelyWindowsIP(ip string) bool {
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
+
+// newOSSet 根据操作系统列表创建集合
+func newOSSet(lists ...[]string) map[string]bool {
+	resultSet := make(map[string]bool)
+	for _, list := range lists {
+		for _, os := range list {
+			resultSet[os] = true
+		}
+	}
+	return resultSet
+}
+
+// osSetFromVersionString 根据软件版本字符串中的发行版标记推断操作系统
+// 例如 "9.18.18-0ubuntu0.22.04.1-Ubuntu"、"9.11.4-P2-RedHat-9.11.4-26.P2.el7"、"10.6.12+maria~ubu2204"
+func osSetFromVersionString(version string) map[string]bool {
+	resultSet := make(map[string]bool)
+	v := strings.ToLower(version)
+
+	switch {
+	case strings.Contains(v, "ubuntu") || strings.Contains(v, "~ubu"):
+		resultSet["Ubuntu"] = true
+	case strings.Contains(v, "debian") || strings.Contains(v, "+deb") || strings.Contains(v, "~deb"):
+		resultSet["Debain"] = true
+	case strings.Contains(v, "centos") || strings.Contains(v, "redhat") || strings.Contains(v, "red hat") ||
+		strings.Contains(v, "rhel") || strings.Contains(v, ".el6") || strings.Contains(v, ".el7") ||
+		strings.Contains(v, ".el8") || strings.Contains(v, ".el9"):
+		resultSet["Centos"] = true
+	case strings.Contains(v, "freebsd"):
+		resultSet["FreeBSD"] = true
+	case strings.Contains(v, "microsoft") || strings.Contains(v, "windows") || strings.Contains(v, "win32") ||
+		strings.Contains(v, "win64"):
+		resultSet = newOSSet(WindowsFamily)
+	}
+
+	return resultSet
+}
+
+// udpExchange 向目标UDP端口发送请求并读取一个响应，超时后按ResendCount重发
+func udpExchange(targetIP string, port int, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(targetIP, strconv.Itoa(port)), time.Duration(MaxRTT)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, 4096)
+	for attempt := 0; attempt <= ResendCount; attempt++ {
+		if _, err = conn.Write(payload); err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Duration(MaxRTT) * time.Second))
+		n, err := conn.Read(buffer)
+		if err == nil {
+			return buffer[:n], nil
+		}
+
+		// 只有超时才重发，端口不可达等错误直接返回
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("no response from %s:%d", targetIP, port)
+}
+
+// osSetFromLinuxKernel 根据Linux内核版本号推断发行版，例如 "5.15.0-91-generic"、"4.19.0-13-amd64"
+func osSetFromLinuxKernel(release string) map[string]bool {
+	resultSet := osSetFromVersionString(release)
+	if len(resultSet) > 0 {
+		return resultSet
+	}
+
+	r := strings.ToLower(release)
+	switch {
+	case strings.HasSuffix(r, "-generic"):
+		resultSet["Ubuntu"] = true
+	case strings.HasSuffix(r, "-amd64") || strings.HasSuffix(r, "-686") || strings.HasSuffix(r, "-arm64"):
+		resultSet["Debain"] = true
+	default:
+		resultSet = newOSSet(LinuxFamily)
+	}
+
+	return resultSet
+}
+
+// windowsOSSetFromVersion 根据Windows NT版本号和build号推断Windows版本
+// 桌面版和服务器版共用build号，因此返回集合中可能同时包含两者
+func windowsOSSetFromVersion(major, minor, build int) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	switch {
+	case build == 26100:
+		resultSet["Windows 11"] = true
+		resultSet["Windows Server 2025"] = true
+	case build == 20348:
+		resultSet["Windows Server 2022"] = true
+	case build >= 22000:
+		resultSet["Windows 11"] = true
+	case build == 17763:
+		resultSet["Windows 10"] = true
+		resultSet["Windows Server 2019"] = true
+	case build == 14393:
+		resultSet["Windows 10"] = true
+		resultSet["Windows Server 2016"] = true
+	case major == 10 || build >= 10240:
+		// Windows 10 之后的部分接口仍然报告6.3，需要结合build号判断
+		resultSet["Windows 10"] = true
+	case major == 6 && minor >= 2:
+		resultSet["Windows 8"] = true
+		resultSet["Windows Server 2012"] = true
+	case major == 6:
+		resultSet["Windows 7"] = true
+		resultSet["Windows Server 2008"] = true
+	case major == 5 && minor >= 2:
+		// 5.2 为Server 2003以及XP x64
+		resultSet["Windows XP"] = true
+		resultSet["Windows Server 2003"] = true
+	case major == 5:
+		resultSet["Windows XP"] = true
+	default:
+		resultSet = newOSSet(WindowsFamily)
+	}
+
+	return resultSet
+}
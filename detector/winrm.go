@@ -0,0 +1,164 @@
+package detector
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WinRMPorts WinRM的HTTP和HTTPS端口
+var WinRMPorts = []int{5985, 5986}
+
+// wsmanIdentifyRequest 不需要认证的WS-Management Identify请求
+const wsmanIdentifyRequest = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" ` +
+	`xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+	`<s:Header/><s:Body><wsmid:Identify/></s:Body></s:Envelope>`
+
+var (
+	// wsmanOSVersionPattern 匹配ProductVersion中的系统版本，例如 "OS: 10.0.17763 SP: 0.0 Stack: 3.0"
+	wsmanOSVersionPattern = regexp.MustCompile(`OS: (\d+)\.(\d+)\.(\d+)`)
+	wsmanElementPattern   = regexp.MustCompile(`<(?:\w+:)?(ProductVendor|ProductVersion|ProtocolVersion)>([^<]*)<`)
+)
+
+// WinRMInfo WS-Management服务信息
+type WinRMInfo struct {
+	Port            int
+	ProductVendor   string
+	ProductVersion  string
+	ProtocolVersion string
+	NTLM            *NTLMChallengeInfo
+}
+
+// WinRMFingerprint 通过WS-Man Identify和HTTP NTLM认证识别Windows版本
+func (d *OSDetector) WinRMFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	var info *WinRMInfo
+	for _, port := range WinRMPorts {
+		if info = d.winrmProbe(targetIP, port); info != nil {
+			break
+		}
+	}
+	if info == nil {
+		return resultSet
+	}
+	d.winrmInfo = info
+
+	if d.Verbose {
+		fmt.Printf("[WinRM] Port: %d, Vendor: %q, Version: %q, Protocol: %q\n",
+			info.Port, info.ProductVendor, info.ProductVersion, info.ProtocolVersion)
+	}
+	d.addDetail("WinRM: %s %s", info.ProductVendor, info.ProductVersion)
+
+	// NTLM Challenge中的版本信息最准确
+	if info.NTLM != nil && info.NTLM.Version != nil {
+		return d.osSetFromNTLMChallenge("WinRM", info.NTLM)
+	}
+
+	switch {
+	case containsIgnoreCase(info.ProductVendor, "microsoft"):
+		if m := wsmanOSVersionPattern.FindStringSubmatch(info.ProductVersion); m != nil {
+			major, _ := strconv.Atoi(m[1])
+			minor, _ := strconv.Atoi(m[2])
+			build, _ := strconv.Atoi(m[3])
+			resultSet = windowsOSSetFromVersion(major, minor, build)
+		} else {
+			resultSet = newOSSet(WindowsFamily)
+		}
+		log.Println("WS-Man Identify显示目标为Microsoft系统:", info.ProductVersion)
+	case containsIgnoreCase(info.ProductVendor, "openwsman"):
+		resultSet = newOSSet(LinuxFamily)
+	}
+	for os := range resultSet {
+		d.osWeights[os] += 4
+	}
+
+	return resultSet
+}
+
+// WinRMInfo 返回WS-Management服务信息，未探测或无响应时为nil
+func (d *OSDetector) WinRMInfo() *WinRMInfo {
+	return d.winrmInfo
+}
+
+// winrmProbe 在指定端口发送Identify请求和NTLM Negotiate
+func (d *OSDetector) winrmProbe(targetIP string, port int) *WinRMInfo {
+	scheme := "http"
+	if port == 5986 {
+		scheme = "https"
+	}
+	url := scheme + "://" + net.JoinHostPort(targetIP, strconv.Itoa(port)) + "/wsman"
+	client := &http.Client{
+		Timeout: time.Duration(MaxRTT*(ResendCount+1)) * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	// 未认证的Identify请求
+	req, err := http.NewRequest("POST", url, strings.NewReader(wsmanIdentifyRequest))
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.Header.Set("WSMANIDENTIFY", "unauthenticated")
+	resp, err := client.Do(req)
+	if err != nil {
+		if d.Verbose {
+			fmt.Printf("[WinRM] Port %d: %v\n", port, err)
+		}
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	info := &WinRMInfo{Port: port}
+	for _, m := range wsmanElementPattern.FindAllStringSubmatch(string(body), -1) {
+		switch m[1] {
+		case "ProductVendor":
+			info.ProductVendor = m[2]
+		case "ProductVersion":
+			info.ProductVersion = m[2]
+		case "ProtocolVersion":
+			info.ProtocolVersion = m[2]
+		}
+	}
+
+	// 携带NTLM Negotiate的请求，401响应中包含Challenge
+	req, err = http.NewRequest("POST", url, nil)
+	if err != nil {
+		return info
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	resp, err = client.Do(req)
+	if err != nil {
+		return info
+	}
+	resp.Body.Close()
+
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || (scheme != "Negotiate" && scheme != "NTLM") {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+		if err != nil {
+			continue
+		}
+		if challenge, err := parseNTLMChallenge(data); err == nil {
+			info.NTLM = challenge
+			break
+		}
+	}
+
+	return info
+}
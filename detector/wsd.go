@@ -0,0 +1,167 @@
+package detector
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// wsdProbeTemplate WS-Discovery Probe消息，参数为MessageID
+const wsdProbeTemplate = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" ` +
+	`xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" ` +
+	`xmlns:wsd="http://schemas.xmlsoap.org/ws/2005/04/discovery">` +
+	`<soap:Header><wsa:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To>` +
+	`<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>` +
+	`<wsa:MessageID>urn:uuid:%s</wsa:MessageID></soap:Header>` +
+	`<soap:Body><wsd:Probe/></soap:Body></soap:Envelope>`
+
+// wsdGetTemplate WS-Transfer Get消息，参数为目标端点地址和MessageID
+const wsdGetTemplate = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" ` +
+	`xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">` +
+	`<soap:Header><wsa:To>%s</wsa:To>` +
+	`<wsa:Action>http://schemas.xmlsoap.org/ws/2004/09/transfer/Get</wsa:Action>` +
+	`<wsa:MessageID>urn:uuid:%s</wsa:MessageID>` +
+	`<wsa:ReplyTo><wsa:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</wsa:Address></wsa:ReplyTo>` +
+	`</soap:Header><soap:Body/></soap:Envelope>`
+
+// wsdElementPattern 匹配带命名空间前缀的简单元素
+var wsdElementPattern = regexp.MustCompile(`<(?:\w+:)?(Address|Types|Scopes|XAddrs|Manufacturer|ModelName|FriendlyName|Computer)(?:\s[^>]*)?>([^<]*)<`)
+
+// WSDInfo WS-Discovery ProbeMatch和设备元数据
+type WSDInfo struct {
+	Address      string // EndpointReference地址
+	Types        string
+	Scopes       string
+	XAddrs       string
+	Manufacturer string
+	ModelName    string
+	FriendlyName string
+	Computer     string // pub:Computer，例如 "DESKTOP-1/Workgroup:WORKGROUP"
+}
+
+// WSDFingerprint 使用存活检测阶段的WS-Discovery响应或重新探测，识别Windows的Function Discovery发布
+func (d *OSDetector) WSDFingerprint(targetIP string) map[string]bool {
+	resultSet := make(map[string]bool)
+
+	info := d.wsdInfo
+	if info == nil {
+		var err error
+		if info, err = wsdProbe(targetIP); err != nil {
+			if d.Verbose {
+				fmt.Printf("[WS-Discovery] No response: %v\n", err)
+			}
+			return resultSet
+		}
+		d.wsdInfo = info
+	}
+	if info.Manufacturer == "" && info.XAddrs != "" {
+		info.fetchMetadata(targetIP)
+	}
+
+	if d.Verbose {
+		fmt.Printf("[WS-Discovery] Address: %s, Types: %q, Scopes: %q, XAddrs: %s\n", info.Address, info.Types, info.Scopes, info.XAddrs)
+		fmt.Printf("[WS-Discovery] Manufacturer: %q, Model: %q, Name: %q, Computer: %q\n",
+			info.Manufacturer, info.ModelName, info.FriendlyName, info.Computer)
+	}
+	d.addDetail("WS-Discovery: %s, %s %s %s", info.Types, info.Manufacturer, info.ModelName, info.Computer)
+
+	// pub:Computer由Windows Vista之后的Function Discovery资源发布服务提供，
+	// 打印机和ONVIF摄像头等设备也会响应WS-Discovery，但类型不同
+	if strings.Contains(info.Types, "Computer") || containsIgnoreCase(info.Manufacturer, "microsoft") || info.Computer != "" {
+		resultSet = newOSSet(WindowsFamily)
+		delete(resultSet, "Windows XP")
+		delete(resultSet, "Windows Server 2003")
+		if strings.Contains(info.Computer, "/Domain:") {
+			log.Println("WS-Discovery元数据显示目标已加入域:", info.Computer)
+		}
+		for os := range resultSet {
+			d.osWeights[os] += 2
+		}
+		log.Println("目标通过WS-Discovery发布计算机信息，可能是Windows系统")
+	}
+
+	return resultSet
+}
+
+// WSDInfo 返回WS-Discovery响应和设备元数据，未探测或无响应时为nil
+func (d *OSDetector) WSDInfo() *WSDInfo {
+	return d.wsdInfo
+}
+
+// wsdProbe 向目标的3702端口单播发送Probe并解析ProbeMatches
+func wsdProbe(targetIP string) (*WSDInfo, error) {
+	response, err := udpExchange(targetIP, 3702, []byte(fmt.Sprintf(wsdProbeTemplate, wsdUUID())))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(response), "ProbeMatch") {
+		return nil, fmt.Errorf("not a WS-Discovery ProbeMatches response")
+	}
+	info := &WSDInfo{}
+	info.parse(string(response))
+	return info, nil
+}
+
+// fetchMetadata 通过WS-Transfer Get读取设备元数据，只访问目标主机
+func (info *WSDInfo) fetchMetadata(targetIP string) {
+	for _, xaddr := range strings.Fields(info.XAddrs) {
+		if !strings.Contains(xaddr, "://"+targetIP+":") {
+			continue
+		}
+		client := &http.Client{Timeout: time.Duration(MaxRTT*(ResendCount+1)) * time.Second}
+		body := fmt.Sprintf(wsdGetTemplate, info.Address, wsdUUID())
+		resp, err := client.Post(xaddr, "application/soap+xml", strings.NewReader(body))
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+		resp.Body.Close()
+		info.parse(string(data))
+		return
+	}
+}
+
+// parse 从SOAP消息中提取关心的字段，只保留首次出现的值
+func (info *WSDInfo) parse(message string) {
+	for _, m := range wsdElementPattern.FindAllStringSubmatch(message, -1) {
+		value := strings.TrimSpace(m[2])
+		var field *string
+		switch m[1] {
+		case "Address":
+			field = &info.Address
+		case "Types":
+			field = &info.Types
+		case "Scopes":
+			field = &info.Scopes
+		case "XAddrs":
+			field = &info.XAddrs
+		case "Manufacturer":
+			field = &info.Manufacturer
+		case "ModelName":
+			field = &info.ModelName
+		case "FriendlyName":
+			field = &info.FriendlyName
+		case "Computer":
+			field = &info.Computer
+		}
+		if *field == "" {
+			*field = value
+		}
+	}
+}
+
+// wsdUUID 生成随机的UUID字符串
+func wsdUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -2,11 +2,13 @@ module github.com/xuemian/osDetector
 
 go 1.23.3
 
-require golang.org/x/net v0.39.0
+require (
+	github.com/hirochachacha/go-smb2 v1.1.0
+	golang.org/x/net v0.39.0
+)
 
 require (
 	github.com/geoffgarside/ber v1.1.0 // indirect
-	github.com/hirochachacha/go-smb2 v1.1.0 // indirect
 	github.com/jfjallid/go-smb v0.6.1 // indirect
 	github.com/jfjallid/gofork v1.7.6 // indirect
 	github.com/jfjallid/gokrb5/v8 v8.4.4 // indirect
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/xuemian/osDetector/detector"
 )
 
 func main() {
 	// 设置命令行参数
-	target := flag.String("t", "", "目标IP地址")
+	target := flag.String("t", "", "目标IP地址或主机名")
 	verbose := flag.Bool("v", false, "显示详细信息")
+	ntpq := flag.Bool("ntpq", false, "发送NTP mode 6/7控制查询获取版本信息")
+	communities := flag.String("c", strings.Join(detector.DefaultSNMPCommunities, ","), "SNMP团体名列表，以逗号分隔")
+	bannerSignatures := flag.String("bs", "", "自定义Banner签名文件，默认使用内置签名")
+	noDNS := flag.Bool("n", false, "禁用正向和反向DNS解析")
+	dnsServer := flag.String("dns", "", "自定义DNS服务器，例如 8.8.8.8 或 10.0.0.1:53")
+	traceroute := flag.String("tr", "", "检测前使用traceroute测量跳数以还原初始TTL，可选 icmp、udp、tcp")
 	flag.Parse()
 
 	// 检查必要参数
@@ -25,20 +32,68 @@ func main() {
 	log.SetFlags(log.Ltime)
 	log.Println("开始对目标:", *target, "进行操作系统识别")
 
-	// 创建检测器实例
-	detector := detector.NewOSDetector(*verbose)
-
-	// 执行存活检测
-	isAlive, isPing := detector.SurvivalDetect(*target)
+	// 每个地址使用独立的检测器实例，避免探测结果互相影响
+	newDetector := func() *detector.OSDetector {
+		d := detector.NewOSDetector(*verbose)
+		d.NTPControlQueries = *ntpq
+		d.SNMPCommunities = strings.Split(*communities, ",")
+		d.BannerSignatureFile = *bannerSignatures
+		d.DisableDNS = *noDNS
+		d.DNSServer = *dnsServer
+		d.TracerouteMethod = *traceroute
+		return d
+	}
 
-	if !isAlive {
-		log.Println("目标：", *target, "可能没有存活，检测结束")
-		os.Exit(0)
+	// 解析目标地址
+	targets, err := newDetector().ResolveTargets(*target)
+	if err != nil {
+		log.Println("目标：", *target, "解析失败：", err)
+		os.Exit(1)
 	}
 
-	// 执行操作系统检测
-	result := detector.DetectOS(*target, isPing)
+	for _, t := range targets {
+		d := newDetector()
+		t.PTRNames = d.ReverseLookup(t.IP)
 
-	// 输出结果
-	fmt.Println("\n操作系统最终检测结果为：", result)
+		// 执行存活检测
+		t.Alive, t.Ping = d.SurvivalDetect(t.IP)
+		if !t.Alive {
+			log.Println("目标：", t, "可能没有存活，检测结束")
+			continue
+		}
+
+		// 执行操作系统检测
+		t.OS = d.DetectOS(t.IP, t.Ping)
+
+		// 输出结果
+		fmt.Println("\n目标：", t)
+		fmt.Println("操作系统最终检测结果为：", t.OS)
+		if t.Route = d.TracerouteResult(); t.Route != nil && t.Route.Reached {
+			fmt.Printf("网络距离：%d 跳（%s traceroute）\n", t.Route.Distance, t.Route.Method)
+		}
+		d.CollectServiceInfo(t)
+		if t.NetBIOS != nil {
+			fmt.Printf("NetBIOS：计算机名 %s，工作组 %s，MAC %s\n", t.NetBIOS.ComputerName, t.NetBIOS.Workgroup, t.NetBIOS.MAC)
+		}
+		if skew, ok := d.ClockSkew(); ok {
+			fmt.Println("目标时钟偏差：", skew)
+		}
+		if t.ISN = d.ISNAnalysis(); t.ISN != nil {
+			fmt.Printf("TCP初始序列号：%s (GCD=%X, ISR=%X, SP=%X)\n", t.ISN.Class, t.ISN.GCD, t.ISN.ISR, t.ISN.SP)
+		}
+		if t.Timestamp = d.TCPTimestampAnalysis(); t.Timestamp != nil && t.Timestamp.Hz > 0 {
+			if t.Timestamp.UptimeUnreliable {
+				fmt.Printf("TCP时间戳时钟频率：%d Hz，估计运行时间：%s（Linux的TSval带有随机偏移，不可靠）\n", t.Timestamp.Hz, t.Timestamp.Uptime)
+			} else {
+				fmt.Printf("TCP时间戳时钟频率：%d Hz，估计运行时间：%s\n", t.Timestamp.Hz, t.Timestamp.Uptime)
+			}
+		}
+		if t.ICMP = d.ICMPLegacyResult(); t.ICMP != nil && t.ICMP.Timestamp && !t.ICMP.NonStandard {
+			fmt.Println("ICMP时间戳时钟偏差：", t.ICMP.ClockOffset)
+		}
+		t.Findings = d.SecurityFindings()
+		for _, finding := range t.Findings {
+			fmt.Println("安全问题：", finding)
+		}
+	}
 }